@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package connrecord records the bytes read and written on a [net.Conn] and
+// replays them through a fake [net.Conn], which allows to turn field measurements
+// into deterministic regression tests for protocol parsers.
+//
+// Use [NewRecorder] to wrap a [net.Conn] such that we write a [Record] for
+// each operation to an [io.Writer] (e.g., a file) using the JSON lines format.
+// Use [NewReplayConn] to read back the records and obtain a [*mocks.Conn]
+// driven by the recording.
+package connrecord
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rbmk-project/common/netipx"
+)
+
+// The operations we record.
+const (
+	// OpOpen is the first record and contains the connection addresses.
+	OpOpen = "open"
+
+	// OpRead is a read operation.
+	OpRead = "read"
+
+	// OpWrite is a write operation.
+	OpWrite = "write"
+
+	// OpClose is a close operation.
+	OpClose = "close"
+)
+
+// Record is a recorded operation.
+type Record struct {
+	// Op is the operation (e.g., [OpRead]).
+	Op string `json:"op"`
+
+	// Data contains the bytes read or written.
+	Data []byte `json:"data,omitempty"`
+
+	// Err is the error that occurred, if any.
+	Err string `json:"err,omitempty"`
+
+	// LocalAddr is the local address, only set for [OpOpen].
+	LocalAddr string `json:"localAddr,omitempty"`
+
+	// Protocol is the connection protocol, only set for [OpOpen].
+	Protocol string `json:"protocol,omitempty"`
+
+	// RemoteAddr is the remote address, only set for [OpOpen].
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+
+	// T is when the operation completed.
+	T time.Time `json:"t"`
+}
+
+// Recorder is a [net.Conn] recording all the operations.
+//
+// Construct using [NewRecorder].
+type Recorder struct {
+	// Conn is the underlying [net.Conn].
+	net.Conn
+
+	// encoder is the JSON encoder.
+	encoder *json.Encoder
+
+	// err is the first error that occurred when writing records.
+	err error
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// timeNow returns the current time.
+	timeNow func() time.Time
+}
+
+// NewRecorder creates a new [*Recorder] wrapping the given [net.Conn] and
+// writing the records to the given [io.Writer]. We immediately write the
+// [OpOpen] record containing the connection addresses, which we convert
+// using [netipx.AddrToAddrPort].
+func NewRecorder(conn net.Conn, w io.Writer) *Recorder {
+	rec := &Recorder{Conn: conn, encoder: json.NewEncoder(w), timeNow: time.Now}
+	rec.write(&Record{
+		Op:         OpOpen,
+		LocalAddr:  netipx.AddrToAddrPort(conn.LocalAddr()).String(),
+		Protocol:   netipx.AddrNetwork(conn.LocalAddr(), ""),
+		RemoteAddr: netipx.AddrToAddrPort(conn.RemoteAddr()).String(),
+	})
+	return rec
+}
+
+// Err returns the first error that occurred when writing records, if any.
+func (rec *Recorder) Err() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.err
+}
+
+// write writes the given record unless we previously failed.
+func (rec *Recorder) write(record *Record) {
+	record.T = rec.timeNow()
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.err == nil {
+		rec.err = rec.encoder.Encode(record)
+	}
+}
+
+// errString returns the string representation of the error or "".
+func errString(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// Read implements [net.Conn].
+func (rec *Recorder) Read(buf []byte) (int, error) {
+	count, err := rec.Conn.Read(buf)
+	rec.write(&Record{Op: OpRead, Data: buf[:count], Err: errString(err)})
+	return count, err
+}
+
+// Write implements [net.Conn].
+func (rec *Recorder) Write(data []byte) (int, error) {
+	count, err := rec.Conn.Write(data)
+	rec.write(&Record{Op: OpWrite, Data: data[:count], Err: errString(err)})
+	return count, err
+}
+
+// Close implements [net.Conn].
+func (rec *Recorder) Close() error {
+	err := rec.Conn.Close()
+	rec.write(&Record{Op: OpClose, Err: errString(err)})
+	return err
+}
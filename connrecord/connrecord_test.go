@@ -0,0 +1,285 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package connrecord
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rbmk-project/common/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", "Wed, 01 Jan 2020 00:00:00 GMT")
+		w.Write([]byte("Hello, World!"))
+	}))
+	defer srv.Close()
+
+	// fetch using the given dial function and return the body
+	fetch := func(dial func(ctx context.Context, network, address string) (net.Conn, error)) string {
+		txp := &http.Transport{DialContext: dial, DisableKeepAlives: true}
+		resp, err := (&http.Client{Transport: txp}).Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	// record the exchange into a file
+	path := filepath.Join(t.TempDir(), "conn.jsonl")
+	filep, err := os.Create(path)
+	require.NoError(t, err)
+	var recorder *Recorder
+	body := fetch(func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		recorder = NewRecorder(conn, filep)
+		return recorder, nil
+	})
+	assert.Equal(t, "Hello, World!", body)
+	require.NoError(t, recorder.Err())
+	require.NoError(t, filep.Close())
+
+	// inspect the records
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	records, err := ReadRecords(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NotEmpty(t, records)
+	assert.Equal(t, OpOpen, records[0].Op)
+	assert.Equal(t, "tcp", records[0].Protocol)
+	assert.Equal(t, srv.Listener.Addr().String(), records[0].RemoteAddr)
+	var ops []string
+	for _, record := range records {
+		ops = append(ops, record.Op)
+		assert.False(t, record.T.IsZero())
+	}
+	assert.Contains(t, ops, OpWrite)
+	assert.Contains(t, ops, OpRead)
+
+	// replay the exchange after shutting down the server
+	srv.Close()
+	var replayed net.Conn
+	body = fetch(func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := NewReplayConn(bytes.NewReader(data))
+		replayed = conn
+		return conn, err
+	})
+	assert.Equal(t, "Hello, World!", body)
+	assert.Equal(t, records[0].RemoteAddr, replayed.RemoteAddr().String())
+	assert.Equal(t, "tcp", replayed.LocalAddr().Network())
+}
+
+func TestNewRecorderWithNilAddresses(t *testing.T) {
+	conn := &mocks.Conn{
+		MockLocalAddr:  func() net.Addr { return nil },
+		MockRemoteAddr: func() net.Addr { return nil },
+	}
+	var out bytes.Buffer
+	NewRecorder(conn, &out)
+	records, err := ReadRecords(&out)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, OpOpen, records[0].Op)
+	assert.Equal(t, "", records[0].Protocol)
+	assert.Equal(t, "[::]:0", records[0].LocalAddr)
+}
+
+// TestReplayStress replays an HTTP exchange many times to make sure the
+// replay does not depend on how the HTTP transport schedules reads and
+// writes, which used to cause "Unsolicited response" errors.
+func TestReplayStress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, World!"))
+	}))
+	defer srv.Close()
+
+	// record the exchange once
+	var recording bytes.Buffer
+	txp := &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return NewRecorder(conn, &recording), nil
+		},
+		DisableKeepAlives: true,
+	}
+	resp, err := (&http.Client{Transport: txp}).Get(srv.URL)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	txp.CloseIdleConnections()
+	data := recording.Bytes()
+
+	// replay it many times
+	for idx := 0; idx < 100; idx++ {
+		txp := &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return NewReplayConn(bytes.NewReader(data))
+			},
+			DisableKeepAlives: true,
+		}
+		resp, err := (&http.Client{Transport: txp}).Get(srv.URL)
+		require.NoError(t, err, "iteration %d", idx)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err, "iteration %d", idx)
+		require.Equal(t, "Hello, World!", string(body), "iteration %d", idx)
+	}
+}
+
+// newRecording returns a recording containing the given records.
+func newRecording(t *testing.T, records ...*Record) io.Reader {
+	var buf bytes.Buffer
+	conn1, conn2 := net.Pipe()
+	defer conn1.Close()
+	defer conn2.Close()
+	recorder := NewRecorder(conn1, &buf)
+	for _, record := range records {
+		recorder.write(record)
+	}
+	require.NoError(t, recorder.Err())
+	return &buf
+}
+
+func TestNewReplayConn(t *testing.T) {
+	t.Run("reads preserve boundaries and replay errors", func(t *testing.T) {
+		conn, err := NewReplayConn(newRecording(t,
+			&Record{Op: OpRead, Data: []byte("abc")},
+			&Record{Op: OpRead, Data: []byte("defgh"), Err: "connection reset by peer"},
+		))
+		require.NoError(t, err)
+		assert.Equal(t, "pipe", conn.RemoteAddr().Network())
+
+		buf := make([]byte, 4)
+		count, err := conn.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "abc", string(buf[:count]))
+		count, err = conn.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "defg", string(buf[:count]))
+		count, err = conn.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "h", string(buf[:count]))
+		_, err = conn.Read(buf)
+		assert.EqualError(t, err, "connection reset by peer")
+		_, err = conn.Read(buf)
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("writes must match the recording", func(t *testing.T) {
+		conn, err := NewReplayConn(newRecording(t,
+			&Record{Op: OpWrite, Data: []byte("GET / HTTP/1.1\r\n")},
+			&Record{Op: OpWrite, Data: []byte("\r\n"), Err: "broken pipe"},
+		))
+		require.NoError(t, err)
+
+		count, err := conn.Write([]byte("GET / "))
+		require.NoError(t, err)
+		assert.Equal(t, 6, count)
+		count, err = conn.Write([]byte("HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, 12, count)
+		_, err = conn.Write([]byte("x"))
+		assert.EqualError(t, err, "broken pipe")
+	})
+
+	t.Run("unexpected writes", func(t *testing.T) {
+		conn, err := NewReplayConn(newRecording(t, &Record{Op: OpWrite, Data: []byte("abc")}))
+		require.NoError(t, err)
+		count, err := conn.Write([]byte("abd"))
+		assert.ErrorIs(t, err, ErrUnexpectedWrite)
+		assert.Equal(t, 0, count)
+		_, err = conn.Write([]byte("abcd"))
+		assert.ErrorIs(t, err, ErrUnexpectedWrite)
+	})
+
+	t.Run("reads wait for the writes recorded before them", func(t *testing.T) {
+		conn, err := NewReplayConn(newRecording(t,
+			&Record{Op: OpWrite, Data: []byte("ping")},
+			&Record{Op: OpRead, Data: []byte("pong")},
+		))
+		require.NoError(t, err)
+
+		done := make(chan string)
+		go func() {
+			buf := make([]byte, 4)
+			count, _ := conn.Read(buf)
+			done <- string(buf[:count])
+		}()
+		select {
+		case <-done:
+			t.Fatal("the read did not wait for the write")
+		case <-time.After(50 * time.Millisecond):
+		}
+		_, err = conn.Write([]byte("pi"))
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("ng"))
+		require.NoError(t, err)
+		assert.Equal(t, "pong", <-done)
+	})
+
+	t.Run("unexpected writes unblock the reads", func(t *testing.T) {
+		conn, err := NewReplayConn(newRecording(t,
+			&Record{Op: OpWrite, Data: []byte("ping")},
+			&Record{Op: OpRead, Data: []byte("pong")},
+		))
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("pang"))
+		assert.ErrorIs(t, err, ErrUnexpectedWrite)
+		_, err = conn.Read(make([]byte, 4))
+		assert.ErrorIs(t, err, ErrUnexpectedWrite)
+	})
+
+	t.Run("close unblocks the reads", func(t *testing.T) {
+		conn, err := NewReplayConn(newRecording(t,
+			&Record{Op: OpWrite, Data: []byte("ping")},
+			&Record{Op: OpRead, Data: []byte("pong")},
+		))
+		require.NoError(t, err)
+		time.AfterFunc(10*time.Millisecond, func() { conn.Close() })
+		_, err = conn.Read(make([]byte, 4))
+		assert.ErrorIs(t, err, net.ErrClosed)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		conn, err := NewReplayConn(newRecording(t, &Record{Op: OpClose}))
+		require.NoError(t, err)
+		require.NoError(t, conn.SetDeadline(time.Now()))
+		require.NoError(t, conn.Close())
+		assert.ErrorIs(t, conn.Close(), net.ErrClosed)
+		_, err = conn.Read(make([]byte, 4))
+		assert.ErrorIs(t, err, net.ErrClosed)
+		_, err = conn.Write([]byte("abc"))
+		assert.ErrorIs(t, err, net.ErrClosed)
+	})
+
+	t.Run("invalid recordings", func(t *testing.T) {
+		_, err := NewReplayConn(strings.NewReader(""))
+		assert.ErrorIs(t, err, ErrNoOpenRecord)
+		_, err = NewReplayConn(strings.NewReader(`{"op":"read"}`))
+		assert.ErrorIs(t, err, ErrNoOpenRecord)
+		_, err = NewReplayConn(strings.NewReader("{"))
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, ErrNoOpenRecord))
+	})
+}
@@ -0,0 +1,242 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package connrecord
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/rbmk-project/common/mocks"
+)
+
+// ErrUnexpectedWrite indicates that a replayed write differs from the recording.
+var ErrUnexpectedWrite = errors.New("connrecord: unexpected write")
+
+// ErrNoOpenRecord indicates that the recording does not start with [OpOpen].
+var ErrNoOpenRecord = errors.New("connrecord: missing open record")
+
+// ReadRecords reads all the records written by a [*Recorder].
+func ReadRecords(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	decoder := json.NewDecoder(r)
+	for {
+		record := &Record{}
+		err := decoder.Decode(record)
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// NewReplayConn reads the records written by a [*Recorder] and returns a
+// [*mocks.Conn] driven by the recording. We ignore the recorded timestamps,
+// thus the replay is deterministic and does not sleep.
+//
+// Reads return the recorded bytes, preserving the boundaries of the recorded
+// reads when the buffer is large enough, followed by the recorded read error
+// or [io.EOF] once the recording is exhausted. Writes must match the recorded
+// bytes, otherwise we return [ErrUnexpectedWrite], but need not be split
+// like the recorded writes. We replay in the recorded order: a read blocks
+// until the code has written all the bytes recorded before it, such that,
+// e.g., an HTTP client does not receive the response before sending the
+// request. After an unexpected write, blocked reads fail with the same error.
+//
+// Recorded errors are replayed as [io.EOF] when the recorded error was
+// [io.EOF] and as errors having the same string otherwise, which allows
+// [github.com/rbmk-project/common/errclass.New] to classify most of them.
+//
+// After Close, reads and writes return [net.ErrClosed]. Setting deadlines
+// always succeeds and has no effect. The addresses are the recorded ones.
+func NewReplayConn(r io.Reader) (*mocks.Conn, error) {
+	records, err := ReadRecords(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) <= 0 || records[0].Op != OpOpen {
+		return nil, ErrNoOpenRecord
+	}
+	open := records[0]
+	rp := &replayer{}
+	rp.cond = sync.NewCond(&rp.mu)
+	var written int
+	for _, record := range records[1:] {
+		switch record.Op {
+		case OpRead:
+			rp.reads = append(rp.reads, &replayRead{Record: record, writtenBefore: written})
+		case OpWrite:
+			rp.writes = append(rp.writes, record)
+			written += len(record.Data)
+		case OpClose:
+			if rp.closeErr == "" {
+				rp.closeErr = record.Err
+			}
+		}
+	}
+	localAddr := newReplayAddr(open.Protocol, open.LocalAddr)
+	remoteAddr := newReplayAddr(open.Protocol, open.RemoteAddr)
+	noDeadline := func(time.Time) error { return nil }
+	return &mocks.Conn{
+		MockRead:             rp.read,
+		MockWrite:            rp.write,
+		MockClose:            rp.close,
+		MockLocalAddr:        func() net.Addr { return localAddr },
+		MockRemoteAddr:       func() net.Addr { return remoteAddr },
+		MockSetDeadline:      noDeadline,
+		MockSetReadDeadline:  noDeadline,
+		MockSetWriteDeadline: noDeadline,
+	}, nil
+}
+
+// newReplayAddr returns the [net.Addr] for the given recorded address.
+func newReplayAddr(network, address string) net.Addr {
+	addrport, err := netip.ParseAddrPort(address)
+	switch {
+	case err == nil && network == "tcp":
+		return net.TCPAddrFromAddrPort(addrport)
+	case err == nil && network == "udp":
+		return net.UDPAddrFromAddrPort(addrport)
+	default:
+		return &replayAddr{network: network, address: address}
+	}
+}
+
+// replayAddr is a [net.Addr] for non-TCP and non-UDP addresses.
+type replayAddr struct {
+	network, address string
+}
+
+// Network implements [net.Addr].
+func (a *replayAddr) Network() string {
+	return a.network
+}
+
+// String implements [net.Addr].
+func (a *replayAddr) String() string {
+	return a.address
+}
+
+// newReplayError returns the error to replay given its string.
+func newReplayError(s string) error {
+	if s == io.EOF.Error() {
+		return io.EOF
+	}
+	return errors.New(s)
+}
+
+// replayRead is a read [*Record] to replay.
+type replayRead struct {
+	*Record
+
+	// writtenBefore is the number of bytes written before the read.
+	writtenBefore int
+}
+
+// replayer implements [NewReplayConn].
+type replayer struct {
+	// closeErr is the recorded close error.
+	closeErr string
+
+	// closed indicates whether we have been closed.
+	closed bool
+
+	// cond allows reads to wait for writes and for close.
+	cond *sync.Cond
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// reads contains the read records to replay.
+	reads []*replayRead
+
+	// writeErr is the error that occurred when matching writes, if any.
+	writeErr error
+
+	// writes contains the write records to match.
+	writes []*Record
+
+	// written is the number of bytes written so far.
+	written int
+}
+
+func (rp *replayer) read(buf []byte) (int, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	for len(rp.reads) > 0 && !rp.closed && rp.writeErr == nil && rp.written < rp.reads[0].writtenBefore {
+		rp.cond.Wait()
+	}
+	if rp.closed {
+		return 0, net.ErrClosed
+	}
+	if len(rp.reads) > 0 && rp.written < rp.reads[0].writtenBefore {
+		return 0, rp.writeErr
+	}
+	for len(rp.reads) > 0 {
+		head := rp.reads[0]
+		if len(head.Data) > 0 {
+			count := copy(buf, head.Data)
+			head.Data = head.Data[count:]
+			return count, nil
+		}
+		rp.reads = rp.reads[1:]
+		if head.Err != "" {
+			return 0, newReplayError(head.Err)
+		}
+	}
+	return 0, io.EOF
+}
+
+func (rp *replayer) write(data []byte) (int, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.closed {
+		return 0, net.ErrClosed
+	}
+	defer rp.cond.Broadcast() // wake up the reads waiting for this write
+	var total int
+	for len(data) > 0 {
+		if len(rp.writes) <= 0 {
+			rp.writeErr = ErrUnexpectedWrite
+			return total, rp.writeErr
+		}
+		head := rp.writes[0]
+		if len(head.Data) <= 0 {
+			if head.Err != "" {
+				return total, newReplayError(head.Err)
+			}
+			rp.writes = rp.writes[1:]
+			continue
+		}
+		count := min(len(data), len(head.Data))
+		if !bytes.Equal(data[:count], head.Data[:count]) {
+			rp.writeErr = ErrUnexpectedWrite
+			return total, rp.writeErr
+		}
+		head.Data, data, total = head.Data[count:], data[count:], total+count
+		rp.written += count
+	}
+	return total, nil
+}
+
+func (rp *replayer) close() error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.closed {
+		return net.ErrClosed
+	}
+	rp.closed = true
+	rp.cond.Broadcast() // wake up the reads waiting for writes
+	if rp.closeErr != "" {
+		return newReplayError(rp.closeErr)
+	}
+	return nil
+}
@@ -1,32 +1,38 @@
 // SPDX-License-Identifier: GPL-3.0-or-later
 
 // Package dialonce provides a way to ensure we dial just once.
+//
+// Besides [Wrap], which allows exactly one dial, this package provides a
+// family of dial policies: [WrapN] allows at most N dials, [WrapPerAddress]
+// allows one dial per distinct address, [Pin] hands out a pre-established
+// [net.Conn] once, and [NewPinnedTransport] forces an [*http.Transport] to
+// use a pre-established [net.Conn] for all its requests.
 package dialonce
 
 import (
 	"context"
 	"errors"
 	"net"
+	"sync"
 	"sync/atomic"
 )
 
 // DialContextFunc is the function that dials a network connection with the given network and address.
 type DialContextFunc = func(ctx context.Context, network, address string) (net.Conn, error)
 
-// singleDialer ensures we dial just once.
-//
-// The zero value is ready to use.
-type singleDialer struct {
-	count atomic.Int32
+// limitedDialer ensures we dial at most limit times.
+type limitedDialer struct {
+	count atomic.Int64
 	dial  DialContextFunc
+	limit int64
 }
 
 // ErrMultipleDial is the error returned when we dial more than once.
 var ErrMultipleDial = errors.New("dialing more than once")
 
 // DialContext dials a network connection with the given network and address.
-func (d *singleDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
-	if d.count.Add(1) > 1 {
+func (d *limitedDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.count.Add(1) > d.limit {
 		return nil, ErrMultipleDial
 	}
 	return d.dial(ctx, network, address)
@@ -36,5 +42,67 @@ func (d *singleDialer) DialContext(ctx context.Context, network, address string)
 //
 // Multiple attempts to dial will return [ErrMultipleDial].
 func Wrap(dial DialContextFunc) DialContextFunc {
-	return (&singleDialer{count: atomic.Int32{}, dial: dial}).DialContext
+	return WrapN(dial, 1)
+}
+
+// WrapN wraps a [DialContextFunc] to ensure we dial at most n times.
+//
+// Failed dials count towards the limit. Attempts to dial more than n
+// times will return [ErrMultipleDial]. When n is zero or negative, we
+// return [ErrMultipleDial] without dialing at all.
+func WrapN(dial DialContextFunc, n int) DialContextFunc {
+	return (&limitedDialer{dial: dial, limit: int64(n)}).DialContext
+}
+
+// perAddressDialer ensures we dial each address just once.
+type perAddressDialer struct {
+	dial   DialContextFunc
+	dialed map[string]bool
+	mu     sync.Mutex
+}
+
+// DialContext dials a network connection with the given network and address.
+func (d *perAddressDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	key := network + " " + address
+	d.mu.Lock()
+	dialed := d.dialed[key]
+	d.dialed[key] = true
+	d.mu.Unlock()
+	if dialed {
+		return nil, ErrMultipleDial
+	}
+	return d.dial(ctx, network, address)
+}
+
+// WrapPerAddress wraps a [DialContextFunc] to ensure we dial each distinct
+// network and address pair just once.
+//
+// Multiple attempts to dial the same network and address
+// will return [ErrMultipleDial].
+func WrapPerAddress(dial DialContextFunc) DialContextFunc {
+	return (&perAddressDialer{dial: dial, dialed: make(map[string]bool)}).DialContext
+}
+
+// pinnedDialer hands out a pre-established connection once.
+type pinnedDialer struct {
+	conn atomic.Pointer[net.Conn]
+}
+
+// DialContext returns the pinned connection regardless of the network and address.
+func (d *pinnedDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn := d.conn.Swap(nil)
+	if conn == nil {
+		return nil, ErrMultipleDial
+	}
+	return *conn, nil
+}
+
+// Pin returns a [DialContextFunc] handing out the given pre-established
+// [net.Conn] on the first dial, regardless of the network and address.
+//
+// Multiple attempts to dial will return [ErrMultipleDial].
+func Pin(conn net.Conn) DialContextFunc {
+	d := &pinnedDialer{}
+	d.conn.Store(&conn)
+	return d.DialContext
 }
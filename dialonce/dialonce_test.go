@@ -84,3 +84,111 @@ func TestWrap(t *testing.T) {
 		}
 	})
 }
+
+func TestWrapN(t *testing.T) {
+	t.Run("allows at most N dials", func(t *testing.T) {
+		dialCount := 0
+		mockDial := func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialCount++
+			return &mockConn{}, nil
+		}
+
+		wrapped := WrapN(mockDial, 3)
+		for idx := 0; idx < 3; idx++ {
+			conn, err := wrapped(context.Background(), "tcp", "example.com:80")
+			if err != nil {
+				t.Errorf("dial %d: unexpected error: %v", idx, err)
+			}
+			if conn == nil {
+				t.Errorf("dial %d: expected connection, got nil", idx)
+			}
+		}
+
+		conn, err := wrapped(context.Background(), "tcp", "example.com:80")
+		if !errors.Is(err, ErrMultipleDial) {
+			t.Errorf("fourth dial: expected ErrMultipleDial, got %v", err)
+		}
+		if conn != nil {
+			t.Error("fourth dial: expected nil connection")
+		}
+		if dialCount != 3 {
+			t.Errorf("expected dial count 3, got %d", dialCount)
+		}
+	})
+
+	t.Run("failed dials count towards the limit", func(t *testing.T) {
+		expectedErr := errors.New("dial error")
+		mockDial := func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, expectedErr
+		}
+
+		wrapped := WrapN(mockDial, 1)
+		if _, err := wrapped(context.Background(), "tcp", "example.com:80"); !errors.Is(err, expectedErr) {
+			t.Errorf("first dial: expected error %v, got %v", expectedErr, err)
+		}
+		if _, err := wrapped(context.Background(), "tcp", "example.com:80"); !errors.Is(err, ErrMultipleDial) {
+			t.Errorf("second dial: expected ErrMultipleDial, got %v", err)
+		}
+	})
+
+	t.Run("zero never dials", func(t *testing.T) {
+		mockDial := func(ctx context.Context, network, address string) (net.Conn, error) {
+			t.Error("unexpected dial")
+			return &mockConn{}, nil
+		}
+
+		wrapped := WrapN(mockDial, 0)
+		if _, err := wrapped(context.Background(), "tcp", "example.com:80"); !errors.Is(err, ErrMultipleDial) {
+			t.Errorf("expected ErrMultipleDial, got %v", err)
+		}
+	})
+}
+
+func TestWrapPerAddress(t *testing.T) {
+	var dialed []string
+	mockDial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = append(dialed, network+" "+address)
+		return &mockConn{}, nil
+	}
+
+	wrapped := WrapPerAddress(mockDial)
+	for _, tc := range []struct {
+		network, address string
+		expectErr        error
+	}{
+		{"tcp", "93.184.216.34:443", nil},
+		{"tcp", "[2606:2800:220:1:248:1893:25c8:1946]:443", nil},
+		{"udp", "93.184.216.34:443", nil},
+		{"tcp", "93.184.216.34:443", ErrMultipleDial},
+		{"udp", "93.184.216.34:443", ErrMultipleDial},
+	} {
+		_, err := wrapped(context.Background(), tc.network, tc.address)
+		if !errors.Is(err, tc.expectErr) {
+			t.Errorf("%s %s: expected %v, got %v", tc.network, tc.address, tc.expectErr, err)
+		}
+	}
+	if len(dialed) != 3 {
+		t.Errorf("expected 3 dials, got %v", dialed)
+	}
+}
+
+func TestPin(t *testing.T) {
+	pinned := &mockConn{}
+	dial := Pin(pinned)
+
+	conn, err := dial(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Errorf("first dial: unexpected error: %v", err)
+	}
+	if conn != pinned {
+		t.Error("first dial: expected the pinned connection")
+	}
+
+	conn, err = dial(context.Background(), "tcp", "example.org:443")
+	if !errors.Is(err, ErrMultipleDial) {
+		t.Errorf("second dial: expected ErrMultipleDial, got %v", err)
+	}
+	if conn != nil {
+		t.Error("second dial: expected nil connection")
+	}
+}
@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dialonce
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ErrPinnedTLSConn is the error returned when using a pinned
+// [*tls.Conn] for a request that does not use TLS.
+var ErrPinnedTLSConn = errors.New("cannot use a pinned TLS connection without TLS")
+
+// NewPinnedTransport returns a new [*http.Transport] using the given
+// pre-established [net.Conn] for its requests, which lets you measure the
+// connection yourself and then force the transport to use it.
+//
+// The transport pools connections by scheme and host, therefore it uses
+// conn for the first request and for the subsequent requests with the same
+// scheme and host, regardless of the host conn is connected to. Requests
+// using another scheme or host need another connection, which is not
+// possible, so they fail with [ErrMultipleDial].
+//
+// When conn is a [*tls.Conn], we assume the handshake is complete and we
+// use HTTP/2 when the negotiated protocol is "h2", while "http" URLs fail
+// with [ErrPinnedTLSConn] without consuming conn. Otherwise, the transport
+// performs the TLS handshake over conn for "https" URLs.
+//
+// We limit the number of connections per host to one, such that the
+// transport reuses conn for subsequent requests. Once the transport
+// closes conn, subsequent requests fail with [ErrMultipleDial].
+func NewPinnedTransport(conn net.Conn) *http.Transport {
+	dial := Pin(conn)
+	txp := &http.Transport{
+		DialContext:       dial,
+		ForceAttemptHTTP2: true,
+		MaxConnsPerHost:   1,
+	}
+	if _, ok := conn.(*tls.Conn); ok {
+		txp.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, ErrPinnedTLSConn
+		}
+		txp.DialTLSContext = dial
+	}
+	return txp
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dialonce
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewPinnedTransport(t *testing.T) {
+	t.Run("with a TCP connection", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.RemoteAddr))
+		}))
+		defer srv.Close()
+
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: NewPinnedTransport(conn)}
+
+		// the requests with the same scheme and host must use the pinned connection
+		for _, URL := range []string{"http://example.com/", "http://example.com/other"} {
+			resp, err := client.Get(URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != conn.LocalAddr().String() {
+				t.Errorf("%s: expected %s, got %s", URL, conn.LocalAddr(), body)
+			}
+		}
+
+		// the requests with another host or scheme would need another connection
+		for _, URL := range []string{"http://www.example.com/", "https://example.com/"} {
+			_, err = client.Get(URL)
+			if !errors.Is(err, ErrMultipleDial) {
+				t.Errorf("%s: expected ErrMultipleDial, got %v", URL, err)
+			}
+		}
+
+		// once the transport closes the connection we cannot dial again
+		client.CloseIdleConnections()
+		_, err = client.Get("http://example.com/")
+		if !errors.Is(err, ErrMultipleDial) {
+			t.Errorf("expected ErrMultipleDial, got %v", err)
+		}
+	})
+
+	t.Run("with a TLS connection", func(t *testing.T) {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("Hello, World!"))
+		}))
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		defer srv.Close()
+
+		pool := x509.NewCertPool()
+		pool.AddCert(srv.Certificate())
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{
+			NextProtos: []string{"h2", "http/1.1"},
+			RootCAs:    pool,
+			ServerName: "example.com",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: NewPinnedTransport(conn)}
+		defer client.CloseIdleConnections()
+
+		// the requests without TLS cannot use the pinned connection
+		_, err = client.Get("http://example.com/")
+		if !errors.Is(err, ErrPinnedTLSConn) {
+			t.Errorf("expected ErrPinnedTLSConn, got %v", err)
+		}
+
+		for idx := 0; idx < 2; idx++ {
+			resp, err := client.Get("https://example.com/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Proto != "HTTP/2.0" {
+				t.Errorf("expected HTTP/2.0, got %s", resp.Proto)
+			}
+			if !strings.HasPrefix(string(body), "Hello") {
+				t.Errorf("unexpected body: %s", body)
+			}
+		}
+	})
+}
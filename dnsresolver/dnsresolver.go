@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package dnsresolver implements name resolution through a chosen resolver
+// rather than through the system resolver.
+//
+// Use [NewStaticResolver] to resolve names using a static map, which is
+// mostly useful for testing. Use [NewResolver] with a [Transport] to send
+// DNS queries to a specific server: [NewUDPTransport] and [NewTCPTransport]
+// implement the classic DNS transports, while [NewHTTPSTransport] implements
+// DNS-over-HTTPS (RFC 8484) using an [*http.Client].
+//
+// The LookupNetIP method of both resolvers is a [LookupFunc], compatible with
+// [github.com/rbmk-project/common/happyeyeballs.Dialer], which allows to
+// construct dialers resolving names through the chosen resolver.
+//
+// # Errors
+//
+// Like the standard library, we return DNS failures as [*net.DNSError],
+// using error strings that [errclass.New] maps to `EDNS_*` classes:
+//
+//   - `no such host` for NXDOMAIN ([errclass.EDNS_NONAME]);
+//
+//   - `no answer from DNS server` for responses without addresses
+//     ([errclass.EDNS_NODATA]);
+//
+//   - `server misbehaving` for SERVFAIL and other unexpected response
+//     codes ([errclass.EDNS_SERVFAIL]);
+//
+//   - `query refused` for REFUSED ([errclass.EDNS_REFUSED]).
+//
+// Transport failures (e.g., timeouts) are returned unmodified.
+//
+// # Logging
+//
+// When a logger is configured, we emit the `dnsLookupStart` and `dnsLookupDone`
+// events for each lookup. The latter contains the resolved `dnsAddrs` or the
+// `err` and its `errClass` (see [errclass.New]). The [*Resolver] also emits
+// `dnsExchangeStart` and `dnsExchangeDone` for each query, including the
+// `dnsQueryType` and the raw query and response, which allows to inspect
+// what the server actually returned (e.g., to spot injected responses).
+// All the events include the `protocol` and `serverAddr` of the resolver,
+// and the done events measure the lookup or query using `t0`, `t`, and
+// `duration`.
+package dnsresolver
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/rbmk-project/common/errclass"
+)
+
+// LookupFunc is the function that resolves a host name to IP addresses, where
+// network is "ip", "ip4", or "ip6". This type is compatible with the LookupNetIP
+// method of [*net.Resolver].
+type LookupFunc = func(ctx context.Context, network, host string) ([]netip.Addr, error)
+
+// The error strings we use for [*net.DNSError].
+const (
+	errNoSuchHost         = "no such host"
+	errNoAnswer           = "no answer from DNS server"
+	errServerMisbehaving  = "server misbehaving"
+	errQueryRefused       = "query refused"
+	errCannotUnmarshalDNS = "cannot unmarshal DNS message"
+)
+
+// newDNSError creates a new [*net.DNSError] for the given host and server.
+func newDNSError(reason, host, server string) *net.DNSError {
+	return &net.DNSError{
+		Err:         reason,
+		Name:        host,
+		Server:      server,
+		IsNotFound:  reason == errNoSuchHost || reason == errNoAnswer,
+		IsTemporary: reason == errServerMisbehaving,
+	}
+}
+
+// logLookupStart logs the `dnsLookupStart` event.
+func logLookupStart(ctx context.Context, logger *slog.Logger,
+	host, protocol, serverAddr string, t0 time.Time) {
+	if logger != nil {
+		logger.InfoContext(
+			ctx,
+			"dnsLookupStart",
+			slog.String("dnsHost", host),
+			slog.String("protocol", protocol),
+			slog.String("serverAddr", serverAddr),
+			slog.Time("t", t0),
+		)
+	}
+}
+
+// logLookupDone logs the `dnsLookupDone` event.
+func logLookupDone(ctx context.Context, logger *slog.Logger, host, protocol,
+	serverAddr string, addrs []netip.Addr, err error, t0, t time.Time) {
+	if logger != nil {
+		saddrs := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			saddrs = append(saddrs, addr.String())
+		}
+		logger.InfoContext(
+			ctx,
+			"dnsLookupDone",
+			slog.Any("err", err),
+			slog.Any("errClass", errclass.New(err)),
+			slog.String("dnsHost", host),
+			slog.Any("dnsAddrs", saddrs),
+			slog.String("protocol", protocol),
+			slog.String("serverAddr", serverAddr),
+			slog.Time("t0", t0),
+			slog.Time("t", t),
+			slog.Duration("duration", t.Sub(t0)),
+		)
+	}
+}
@@ -0,0 +1,298 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsresolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/rbmk-project/common/dnstest"
+	"github.com/rbmk-project/common/errclass"
+	"github.com/rbmk-project/common/happyeyeballs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// make sure the lookup functions are compatible with the happyeyeballs package
+var (
+	_ LookupFunc = (&happyeyeballs.Dialer{}).LookupNetIP
+	_ LookupFunc = NewStaticResolver(nil, nil).LookupNetIP
+	_ LookupFunc = NewResolver(nil, nil).LookupNetIP
+)
+
+// testZone contains the records served by the test servers.
+var testZone = map[string][]netip.Addr{
+	"dns.google.": {
+		netip.MustParseAddr("8.8.8.8"),
+		netip.MustParseAddr("8.8.4.4"),
+		netip.MustParseAddr("2001:4860:4860::8888"),
+	},
+	"v4only.example.": {netip.MustParseAddr("192.0.2.1")},
+}
+
+// newTestServer starts a [*dnstest.Server] serving [testZone].
+func newTestServer(t *testing.T) *dnstest.Server {
+	config := dnstest.NewConfig()
+	config.Records = testZone
+	config.RCodes["servfail.example"] = dnsmessage.RCodeServerFailure
+	config.RCodes["refused.example"] = dnsmessage.RCodeRefused
+	srv := dnstest.NewServer(config)
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+// parseEvents parses the JSON log lines in the given buffer.
+func parseEvents(t *testing.T, out *bytes.Buffer) []map[string]any {
+	var events []map[string]any
+	decoder := json.NewDecoder(out)
+	for decoder.More() {
+		var event map[string]any
+		require.NoError(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestResolver(t *testing.T) {
+	srv := newTestServer(t)
+	httpsServer := httptest.NewTLSServer(srv)
+	defer httpsServer.Close()
+	transports := []Transport{
+		NewUDPTransport(srv.UDPAddr),
+		NewTCPTransport(srv.TCPAddr),
+		NewHTTPSTransport(httpsServer.Client(), httpsServer.URL),
+	}
+
+	tests := []struct {
+		name     string
+		network  string
+		host     string
+		expect   []string
+		errClass string
+	}{
+		{"ip", "ip", "dns.google", []string{"2001:4860:4860::8888", "8.8.8.8", "8.8.4.4"}, ""},
+		{"ip4", "ip4", "DNS.GOOGLE.", []string{"8.8.8.8", "8.8.4.4"}, ""},
+		{"ip6", "ip6", "dns.google", []string{"2001:4860:4860::8888"}, ""},
+		{"ip with only IPv4", "ip", "v4only.example", []string{"192.0.2.1"}, ""},
+		{"IP address", "ip", "::1", []string{"::1"}, ""},
+		{"NODATA", "ip6", "v4only.example", nil, errclass.EDNS_NODATA},
+		{"NXDOMAIN", "ip", "nxdomain.example", nil, errclass.EDNS_NONAME},
+		{"SERVFAIL", "ip4", "servfail.example", nil, errclass.EDNS_SERVFAIL},
+		{"REFUSED", "ip4", "refused.example", nil, errclass.EDNS_REFUSED},
+	}
+
+	for _, txp := range transports {
+		for _, tt := range tests {
+			t.Run(txp.Protocol()+"/"+tt.name, func(t *testing.T) {
+				var out bytes.Buffer
+				reso := NewResolver(txp, slog.New(slog.NewJSONHandler(&out, nil)))
+				addrs, err := reso.LookupNetIP(context.Background(), tt.network, tt.host)
+				assert.Equal(t, tt.errClass, errclass.New(err))
+
+				var got []string
+				for _, addr := range addrs {
+					got = append(got, addr.String())
+				}
+				assert.Equal(t, tt.expect, got)
+
+				if err != nil {
+					var dnsErr *net.DNSError
+					require.True(t, errors.As(err, &dnsErr))
+					assert.Equal(t, tt.host, dnsErr.Name)
+					assert.Equal(t, txp.ServerAddr(), dnsErr.Server)
+				}
+
+				events := parseEvents(t, &out)
+				require.NotEmpty(t, events)
+				first, last := events[0], events[len(events)-1]
+				assert.Equal(t, "dnsLookupStart", first["msg"])
+				assert.Equal(t, "dnsLookupDone", last["msg"])
+				assert.Equal(t, tt.errClass, last["errClass"])
+				assert.Equal(t, txp.Protocol(), last["protocol"])
+				assert.Equal(t, txp.ServerAddr(), last["serverAddr"])
+				for _, event := range events[1 : len(events)-1] {
+					assert.Contains(t, []any{"dnsExchangeStart", "dnsExchangeDone"}, event["msg"])
+					assert.NotEmpty(t, event["dnsRawQuery"])
+				}
+			})
+		}
+	}
+}
+
+func TestTransportFailures(t *testing.T) {
+	t.Run("UDP ignores responses with the wrong ID", func(t *testing.T) {
+		pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer pconn.Close()
+		go func() {
+			buffer := make([]byte, 1024)
+			count, addr, err := pconn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			pconn.WriteTo([]byte{buffer[0] ^ 0xff, buffer[1], 1}, addr)
+			pconn.WriteTo(append(buffer[:count], 2), addr)
+		}()
+
+		txp := NewUDPTransport(pconn.LocalAddr().String())
+		rawResp, err := txp.Exchange(context.Background(), []byte{0xde, 0xad})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0xde, 0xad, 2}, rawResp)
+	})
+
+	t.Run("UDP timeout", func(t *testing.T) {
+		pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer pconn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		reso := NewResolver(NewUDPTransport(pconn.LocalAddr().String()), nil)
+		addrs, err := reso.LookupNetIP(ctx, "ip", "dns.google")
+		assert.Nil(t, addrs)
+		assert.Equal(t, errclass.ETIMEDOUT, errclass.New(err))
+	})
+
+	t.Run("UDP cancellation", func(t *testing.T) {
+		pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer pconn.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		txp := NewUDPTransport(pconn.LocalAddr().String())
+		_, err = txp.Exchange(ctx, []byte{0, 1})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("TCP connection refused", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		address := listener.Addr().String()
+		listener.Close()
+
+		reso := NewResolver(NewTCPTransport(address), nil)
+		_, err = reso.LookupNetIP(context.Background(), "ip4", "dns.google")
+		assert.Equal(t, errclass.ECONNREFUSED, errclass.New(err))
+	})
+
+	t.Run("TCP query too large", func(t *testing.T) {
+		txp := NewTCPTransport("127.0.0.1:53")
+		_, err := txp.Exchange(context.Background(), make([]byte, 65536))
+		assert.ErrorIs(t, err, ErrQueryTooLarge)
+	})
+
+	t.Run("HTTPS unexpected status and content type", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/404" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+		}))
+		defer srv.Close()
+
+		_, err := NewHTTPSTransport(nil, srv.URL+"/404").Exchange(context.Background(), nil)
+		assert.ErrorIs(t, err, ErrHTTPStatus)
+		_, err = NewHTTPSTransport(nil, srv.URL).Exchange(context.Background(), nil)
+		assert.ErrorIs(t, err, ErrContentType)
+		_, err = NewHTTPSTransport(nil, "\t").Exchange(context.Background(), nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestParseResponse(t *testing.T) {
+	question, err := newQuestion("dns.google", dnsmessage.TypeA)
+	require.NoError(t, err)
+	newResponse := func(header dnsmessage.Header, questions ...dnsmessage.Question) []byte {
+		msg := dnsmessage.Message{Header: header, Questions: questions}
+		raw, err := msg.Pack()
+		require.NoError(t, err)
+		return raw
+	}
+	otherQuestion := question
+	otherQuestion.Type = dnsmessage.TypeAAAA
+
+	tests := []struct {
+		name    string
+		rawResp []byte
+		expect  string
+	}{
+		{"garbage", []byte{1}, "cannot unmarshal DNS message"},
+		{"not a response", newResponse(dnsmessage.Header{ID: 1}, question), "cannot unmarshal DNS message"},
+		{"wrong ID", newResponse(dnsmessage.Header{ID: 2, Response: true}, question), "cannot unmarshal DNS message"},
+		{"no question", newResponse(dnsmessage.Header{ID: 1, Response: true}), "cannot unmarshal DNS message"},
+		{"wrong question", newResponse(dnsmessage.Header{ID: 1, Response: true}, otherQuestion), "cannot unmarshal DNS message"},
+		{"unexpected rcode", newResponse(dnsmessage.Header{ID: 1, Response: true, RCode: dnsmessage.RCodeFormatError}, question), "server misbehaving"},
+		{"no answers", newResponse(dnsmessage.Header{ID: 1, Response: true}, question), "no answer from DNS server"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, err := parseResponse(1, question, tt.rawResp, "dns.google", "127.0.0.1:53")
+			assert.Nil(t, addrs)
+			var dnsErr *net.DNSError
+			require.True(t, errors.As(err, &dnsErr))
+			assert.Equal(t, tt.expect, dnsErr.Err)
+		})
+	}
+}
+
+func TestStaticResolver(t *testing.T) {
+	var out bytes.Buffer
+	reso := NewStaticResolver(testZone, slog.New(slog.NewJSONHandler(&out, nil)))
+
+	addrs, err := reso.LookupNetIP(context.Background(), "ip4", "DNS.Google")
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("8.8.8.8"), netip.MustParseAddr("8.8.4.4")}, addrs)
+
+	_, err = reso.LookupNetIP(context.Background(), "ip6", "v4only.example")
+	assert.Equal(t, errclass.EDNS_NODATA, errclass.New(err))
+
+	_, err = reso.LookupNetIP(context.Background(), "ip", "nxdomain.example")
+	assert.Equal(t, errclass.EDNS_NONAME, errclass.New(err))
+
+	events := parseEvents(t, &out)
+	require.Len(t, events, 6)
+	assert.Equal(t, "dnsLookupDone", events[1]["msg"])
+	assert.Equal(t, []any{"8.8.8.8", "8.8.4.4"}, events[1]["dnsAddrs"])
+	assert.Equal(t, "static", events[1]["protocol"])
+}
+
+func Example_happyEyeballs() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	// Resolve names using a static map rather than the system resolver
+	// and use the result to dial with the Happy Eyeballs algorithm. Likewise,
+	// we could resolve using DNS-over-UDP by using:
+	//
+	//	NewResolver(NewUDPTransport("8.8.8.8:53"), nil).LookupNetIP
+	hosts := map[string][]netip.Addr{"example.com": {netip.MustParseAddr("127.0.0.1")}}
+	dialer := happyeyeballs.NewDialer(nil)
+	dialer.LookupNetIP = NewStaticResolver(hosts, nil).LookupNetIP
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", net.JoinHostPort("example.com", port))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Println(conn.RemoteAddr().(*net.TCPAddr).IP)
+	// Output: 127.0.0.1
+}
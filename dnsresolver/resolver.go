@@ -0,0 +1,245 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsresolver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/rbmk-project/common/errclass"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Transport sends DNS queries to a DNS server.
+type Transport interface {
+	// Exchange sends the raw query and returns the raw response.
+	Exchange(ctx context.Context, query []byte) ([]byte, error)
+
+	// Protocol returns the protocol we use (e.g., "udp").
+	Protocol() string
+
+	// ServerAddr returns the server address or URL.
+	ServerAddr() string
+}
+
+// Resolver resolves names by sending queries using a [Transport].
+//
+// For the "ip" network, we query for AAAA and then for A, and we return
+// the addresses in this order. We fail only if both queries fail, in
+// which case we return the error of the AAAA query.
+//
+// Construct using [NewResolver].
+type Resolver struct {
+	// Logger is the OPTIONAL logger to use. If nil, we don't log.
+	Logger *slog.Logger
+
+	// TimeNow is the OPTIONAL function to get the current time.
+	// If nil, we use [time.Now].
+	TimeNow func() time.Time
+
+	// Transport is the MANDATORY [Transport] to use.
+	Transport Transport
+}
+
+// NewResolver creates a new [*Resolver] using the given [Transport] and logger.
+func NewResolver(txp Transport, logger *slog.Logger) *Resolver {
+	return &Resolver{Logger: logger, TimeNow: time.Now, Transport: txp}
+}
+
+// timeNow returns the current time using TimeNow or [time.Now].
+func (r *Resolver) timeNow() time.Time {
+	if r.TimeNow != nil {
+		return r.TimeNow()
+	}
+	return time.Now()
+}
+
+// LookupNetIP implements [LookupFunc].
+func (r *Resolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	t0 := r.timeNow()
+	protocol, serverAddr := r.Transport.Protocol(), r.Transport.ServerAddr()
+	logLookupStart(ctx, r.Logger, host, protocol, serverAddr, t0)
+	addrs, err := r.lookup(ctx, network, host)
+	logLookupDone(ctx, r.Logger, host, protocol, serverAddr, addrs, err, t0, r.timeNow())
+	return addrs, err
+}
+
+// lookup implements LookupNetIP.
+func (r *Resolver) lookup(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	// Resolving IP addresses is a no-op like it happens for [*net.Resolver].
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+
+	switch network {
+	case "ip4":
+		return r.query(ctx, host, dnsmessage.TypeA)
+	case "ip6":
+		return r.query(ctx, host, dnsmessage.TypeAAAA)
+	}
+	addrs6, err6 := r.query(ctx, host, dnsmessage.TypeAAAA)
+	if errors.Is(err6, context.Canceled) || errors.Is(err6, context.DeadlineExceeded) {
+		return nil, err6
+	}
+	addrs4, err4 := r.query(ctx, host, dnsmessage.TypeA)
+	if err6 != nil && err4 != nil {
+		return nil, err6
+	}
+	return append(addrs6, addrs4...), nil
+}
+
+// query sends a query for the given type and parses the response.
+func (r *Resolver) query(ctx context.Context, host string, qtype dnsmessage.Type) ([]netip.Addr, error) {
+	question, err := newQuestion(host, qtype)
+	if err != nil {
+		return nil, newDNSError(errNoSuchHost, host, r.Transport.ServerAddr())
+	}
+	id := uint16(rand.Uint32())
+	query, err := newQuery(id, question)
+	if err != nil {
+		return nil, err
+	}
+
+	t0 := r.timeNow()
+	r.logExchangeStart(ctx, host, qtype, query, t0)
+	rawResp, err := r.Transport.Exchange(ctx, query)
+	r.logExchangeDone(ctx, host, qtype, query, rawResp, err, t0, r.timeNow())
+	if err != nil {
+		return nil, err
+	}
+	return parseResponse(id, question, rawResp, host, r.Transport.ServerAddr())
+}
+
+// newQuestion creates the question for the given host and type.
+func newQuestion(host string, qtype dnsmessage.Type) (dnsmessage.Question, error) {
+	if !strings.HasSuffix(host, ".") {
+		host += "."
+	}
+	name, err := dnsmessage.NewName(host)
+	if err != nil {
+		return dnsmessage.Question{}, err
+	}
+	return dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET}, nil
+}
+
+// maxUDPPayloadSize is the UDP payload size we advertise using EDNS(0),
+// which follows the recommendation of the DNS flag day 2020.
+const maxUDPPayloadSize = 1232
+
+// newQuery creates a raw query with the given ID and question.
+func newQuery(id uint16, question dnsmessage.Question) ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+	if err := builder.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(maxUDPPayloadSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	if err := builder.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+	return builder.Finish()
+}
+
+// parseResponse parses the raw response to the query with the given ID
+// and question and returns the addresses it contains.
+func parseResponse(id uint16, question dnsmessage.Question,
+	rawResp []byte, host, server string) ([]netip.Addr, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(rawResp)
+	if err != nil || !header.Response || header.ID != id {
+		return nil, newDNSError(errCannotUnmarshalDNS, host, server)
+	}
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, newDNSError(errNoSuchHost, host, server)
+	case dnsmessage.RCodeRefused:
+		return nil, newDNSError(errQueryRefused, host, server)
+	default:
+		return nil, newDNSError(errServerMisbehaving, host, server)
+	}
+
+	questions, err := parser.AllQuestions()
+	if err != nil || len(questions) != 1 || !sameQuestion(questions[0], question) {
+		return nil, newDNSError(errCannotUnmarshalDNS, host, server)
+	}
+	answers, err := parser.AllAnswers()
+	if err != nil {
+		return nil, newDNSError(errCannotUnmarshalDNS, host, server)
+	}
+
+	var addrs []netip.Addr
+	for _, answer := range answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			if question.Type == dnsmessage.TypeA {
+				addrs = append(addrs, netip.AddrFrom4(body.A))
+			}
+		case *dnsmessage.AAAAResource:
+			if question.Type == dnsmessage.TypeAAAA {
+				addrs = append(addrs, netip.AddrFrom16(body.AAAA))
+			}
+		}
+	}
+	if len(addrs) <= 0 {
+		return nil, newDNSError(errNoAnswer, host, server)
+	}
+	return addrs, nil
+}
+
+// sameQuestion returns whether the response question matches the query question.
+func sameQuestion(got, expect dnsmessage.Question) bool {
+	return got.Type == expect.Type && got.Class == expect.Class &&
+		strings.EqualFold(got.Name.String(), expect.Name.String())
+}
+
+func (r *Resolver) logExchangeStart(ctx context.Context,
+	host string, qtype dnsmessage.Type, query []byte, t0 time.Time) {
+	if r.Logger != nil {
+		r.Logger.InfoContext(
+			ctx,
+			"dnsExchangeStart",
+			slog.String("dnsHost", host),
+			slog.String("dnsQueryType", strings.TrimPrefix(qtype.String(), "Type")),
+			slog.Any("dnsRawQuery", query),
+			slog.String("protocol", r.Transport.Protocol()),
+			slog.String("serverAddr", r.Transport.ServerAddr()),
+			slog.Time("t", t0),
+		)
+	}
+}
+
+func (r *Resolver) logExchangeDone(ctx context.Context, host string, qtype dnsmessage.Type,
+	query, rawResp []byte, err error, t0, t time.Time) {
+	if r.Logger != nil {
+		r.Logger.InfoContext(
+			ctx,
+			"dnsExchangeDone",
+			slog.Any("err", err),
+			slog.Any("errClass", errclass.New(err)),
+			slog.String("dnsHost", host),
+			slog.String("dnsQueryType", strings.TrimPrefix(qtype.String(), "Type")),
+			slog.Any("dnsRawQuery", query),
+			slog.Any("dnsRawResponse", rawResp),
+			slog.String("protocol", r.Transport.Protocol()),
+			slog.String("serverAddr", r.Transport.ServerAddr()),
+			slog.Time("t0", t0),
+			slog.Time("t", t),
+			slog.Duration("duration", t.Sub(t0)),
+		)
+	}
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsresolver
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// StaticResolver resolves names using a static map.
+//
+// Construct using [NewStaticResolver].
+type StaticResolver struct {
+	// Hosts maps host names to their addresses. We match the names
+	// ignoring the case and the trailing dot.
+	Hosts map[string][]netip.Addr
+
+	// Logger is the OPTIONAL logger to use. If nil, we don't log.
+	Logger *slog.Logger
+
+	// TimeNow is the OPTIONAL function to get the current time.
+	// If nil, we use [time.Now].
+	TimeNow func() time.Time
+}
+
+// NewStaticResolver creates a new [*StaticResolver] using the given hosts and logger.
+func NewStaticResolver(hosts map[string][]netip.Addr, logger *slog.Logger) *StaticResolver {
+	return &StaticResolver{Hosts: hosts, Logger: logger, TimeNow: time.Now}
+}
+
+// timeNow returns the current time using TimeNow or [time.Now].
+func (r *StaticResolver) timeNow() time.Time {
+	if r.TimeNow != nil {
+		return r.TimeNow()
+	}
+	return time.Now()
+}
+
+// LookupNetIP implements [LookupFunc].
+//
+// We return `no such host` when the host is not in the map and `no answer
+// from DNS server` when it has no addresses for the given network.
+func (r *StaticResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	t0 := r.timeNow()
+	logLookupStart(ctx, r.Logger, host, "static", "", t0)
+	addrs, err := r.lookup(network, host)
+	logLookupDone(ctx, r.Logger, host, "static", "", addrs, err, t0, r.timeNow())
+	return addrs, err
+}
+
+// lookup implements LookupNetIP.
+func (r *StaticResolver) lookup(network, host string) ([]netip.Addr, error) {
+	var (
+		all   []netip.Addr
+		found bool
+	)
+	name := strings.TrimSuffix(host, ".")
+	for key, addrs := range r.Hosts {
+		if strings.EqualFold(strings.TrimSuffix(key, "."), name) {
+			all, found = append(all, addrs...), true
+		}
+	}
+	if !found {
+		return nil, newDNSError(errNoSuchHost, host, "")
+	}
+	addrs := filterAddrs(network, all)
+	if len(addrs) <= 0 {
+		return nil, newDNSError(errNoAnswer, host, "")
+	}
+	return addrs, nil
+}
+
+// filterAddrs returns the addresses matching the "ip", "ip4", or "ip6" network.
+func filterAddrs(network string, addrs []netip.Addr) []netip.Addr {
+	var filtered []netip.Addr
+	for _, addr := range addrs {
+		switch {
+		case network == "ip4" && !addr.Unmap().Is4():
+		case network == "ip6" && addr.Unmap().Is4():
+		default:
+			filtered = append(filtered, addr)
+		}
+	}
+	return filtered
+}
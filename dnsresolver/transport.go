@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsresolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rbmk-project/common/dialonce"
+)
+
+// dialContext dials using the given [dialonce.DialContextFunc] or a [*net.Dialer].
+func dialContext(ctx context.Context, dial dialonce.DialContextFunc, network, address string) (net.Conn, error) {
+	if dial != nil {
+		return dial(ctx, network, address)
+	}
+	return (&net.Dialer{}).DialContext(ctx, network, address)
+}
+
+// exchangeConn dials a connection and runs the given function with it, ensuring
+// that the context deadline and cancellation interrupt any pending I/O.
+func exchangeConn(ctx context.Context, dial dialonce.DialContextFunc, network, address string,
+	fx func(conn net.Conn) ([]byte, error)) ([]byte, error) {
+	conn, err := dialContext(ctx, dial, network, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+	rawResp, err := fx(conn)
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return rawResp, err
+}
+
+// sameID returns whether the query and the response have the same ID.
+func sameID(query, rawResp []byte) bool {
+	return len(query) >= 2 && len(rawResp) >= 2 && bytes.Equal(query[:2], rawResp[:2])
+}
+
+// UDPTransport is a [Transport] using DNS-over-UDP.
+//
+// We ignore responses with an ID different from the query ID, and we
+// return truncated responses as is, without retrying using TCP.
+//
+// Construct using [NewUDPTransport].
+type UDPTransport struct {
+	// Address is the MANDATORY server address (e.g., "8.8.8.8:53").
+	Address string
+
+	// Dial is the OPTIONAL function to dial the server. If nil,
+	// we use a zero-initialized [*net.Dialer].
+	Dial dialonce.DialContextFunc
+}
+
+// NewUDPTransport creates a new [*UDPTransport] using the given server address.
+func NewUDPTransport(address string) *UDPTransport {
+	return &UDPTransport{Address: address}
+}
+
+var _ Transport = &UDPTransport{}
+
+// Exchange implements [Transport].
+func (t *UDPTransport) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	return exchangeConn(ctx, t.Dial, "udp", t.Address, func(conn net.Conn) ([]byte, error) {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buffer := make([]byte, 65535)
+		for {
+			count, err := conn.Read(buffer)
+			if err != nil {
+				return nil, err
+			}
+			if rawResp := buffer[:count]; sameID(query, rawResp) {
+				return rawResp, nil
+			}
+		}
+	})
+}
+
+// Protocol implements [Transport].
+func (t *UDPTransport) Protocol() string {
+	return "udp"
+}
+
+// ServerAddr implements [Transport].
+func (t *UDPTransport) ServerAddr() string {
+	return t.Address
+}
+
+// TCPTransport is a [Transport] using DNS-over-TCP.
+//
+// We use a new connection for each query.
+//
+// Construct using [NewTCPTransport].
+type TCPTransport struct {
+	// Address is the MANDATORY server address (e.g., "8.8.8.8:53").
+	Address string
+
+	// Dial is the OPTIONAL function to dial the server. If nil,
+	// we use a zero-initialized [*net.Dialer].
+	Dial dialonce.DialContextFunc
+}
+
+// NewTCPTransport creates a new [*TCPTransport] using the given server address.
+func NewTCPTransport(address string) *TCPTransport {
+	return &TCPTransport{Address: address}
+}
+
+var _ Transport = &TCPTransport{}
+
+// ErrQueryTooLarge indicates that the query does not fit into a DNS-over-TCP frame.
+var ErrQueryTooLarge = errors.New("dnsresolver: query too large")
+
+// Exchange implements [Transport].
+func (t *TCPTransport) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) > 65535 {
+		return nil, ErrQueryTooLarge
+	}
+	return exchangeConn(ctx, t.Dial, "tcp", t.Address, func(conn net.Conn) ([]byte, error) {
+		frame := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+		if _, err := conn.Write(append(frame, query...)); err != nil {
+			return nil, err
+		}
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return nil, err
+		}
+		rawResp := make([]byte, binary.BigEndian.Uint16(header))
+		if _, err := io.ReadFull(conn, rawResp); err != nil {
+			return nil, err
+		}
+		return rawResp, nil
+	})
+}
+
+// Protocol implements [Transport].
+func (t *TCPTransport) Protocol() string {
+	return "tcp"
+}
+
+// ServerAddr implements [Transport].
+func (t *TCPTransport) ServerAddr() string {
+	return t.Address
+}
+
+// HTTPSTransport is a [Transport] using DNS-over-HTTPS (RFC 8484).
+//
+// We send each query using the POST method.
+//
+// Construct using [NewHTTPSTransport].
+type HTTPSTransport struct {
+	// Client is the OPTIONAL [*http.Client] to use. If nil,
+	// we use [http.DefaultClient].
+	Client *http.Client
+
+	// URL is the MANDATORY server URL (e.g., "https://dns.google/dns-query").
+	URL string
+}
+
+// NewHTTPSTransport creates a new [*HTTPSTransport] using the given client and URL.
+func NewHTTPSTransport(client *http.Client, URL string) *HTTPSTransport {
+	return &HTTPSTransport{Client: client, URL: URL}
+}
+
+var _ Transport = &HTTPSTransport{}
+
+// ErrHTTPStatus indicates that the DNS-over-HTTPS server did not return 200.
+var ErrHTTPStatus = errors.New("dnsresolver: unexpected HTTP status")
+
+// ErrContentType indicates that the DNS-over-HTTPS response has the wrong content type.
+var ErrContentType = errors.New("dnsresolver: unexpected content type")
+
+// dnsMessageContentType is the content type defined by RFC 8484.
+const dnsMessageContentType = "application/dns-message"
+
+// Exchange implements [Transport].
+func (t *HTTPSTransport) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", t.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dnsMessageContentType)
+	req.Header.Set("Content-Type", dnsMessageContentType)
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %d", ErrHTTPStatus, resp.StatusCode)
+	}
+	if ctype := resp.Header.Get("Content-Type"); ctype != dnsMessageContentType {
+		return nil, fmt.Errorf("%w: %q", ErrContentType, ctype)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 65535))
+}
+
+// Protocol implements [Transport].
+func (t *HTTPSTransport) Protocol() string {
+	return "https"
+}
+
+// ServerAddr implements [Transport].
+func (t *HTTPSTransport) ServerAddr() string {
+	return t.URL
+}
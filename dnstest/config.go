@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnstest
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/rbmk-project/common/runtimex"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Config contains configuration for [NewServer].
+//
+// We match the names ignoring the case and the trailing dot. We return
+// NXDOMAIN for names not appearing in any field, and we return a response
+// without answers (aka NODATA) for names in Records without addresses of
+// the queried family.
+type Config struct {
+	// RCodes maps names to the response code to return instead of answering
+	// (e.g., [dnsmessage.RCodeServerFailure] to simulate SERVFAIL).
+	RCodes map[string]dnsmessage.RCode
+
+	// Records maps names to the addresses we return for A and AAAA queries.
+	Records map[string][]netip.Addr
+
+	// Spoofed maps names to the addresses of a spoofed response. Over UDP,
+	// we send the spoofed response before the legitimate one, like on-path
+	// censors do. Over TCP and HTTPS, we only send the spoofed response.
+	Spoofed map[string][]netip.Addr
+
+	// Timeouts contains the names for which we never respond.
+	Timeouts []string
+}
+
+// NewConfig creates an empty [*Config].
+func NewConfig() *Config {
+	return &Config{
+		RCodes:  map[string]dnsmessage.RCode{},
+		Records: map[string][]netip.Addr{},
+		Spoofed: map[string][]netip.Addr{},
+	}
+}
+
+// NewConfigExampleCom creates a [*Config] resolving example.com and
+// www.example.com to 127.0.0.1 and ::1, which matches the certificate
+// created using [github.com/rbmk-project/common/selfsignedcert.NewConfigExampleCom].
+func NewConfigExampleCom() *Config {
+	config := NewConfig()
+	addrs := []netip.Addr{netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("::1")}
+	config.Records["example.com"] = addrs
+	config.Records["www.example.com"] = addrs
+	return config
+}
+
+// sameName returns whether two names are equal ignoring the case and the trailing dot.
+func sameName(left, right string) bool {
+	return strings.EqualFold(strings.TrimSuffix(left, "."), strings.TrimSuffix(right, "."))
+}
+
+// respond returns the raw responses to send for the given raw query, in order,
+// which are empty if we should not respond. The udp flag indicates whether
+// we should send both the spoofed and the legitimate response.
+func (c *Config) respond(rawQuery []byte, udp bool) [][]byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(rawQuery)
+	if err != nil || header.Response {
+		return nil
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil || len(questions) != 1 {
+		return [][]byte{newResponse(header, questions, dnsmessage.RCodeFormatError, nil)}
+	}
+	question := questions[0]
+	name := question.Name.String()
+
+	for _, candidate := range c.Timeouts {
+		if sameName(candidate, name) {
+			return nil
+		}
+	}
+
+	var responses [][]byte
+	for candidate, addrs := range c.Spoofed {
+		if sameName(candidate, name) {
+			responses = append(responses, newResponse(header, questions, dnsmessage.RCodeSuccess,
+				newAnswers(question, addrs)))
+			if !udp {
+				return responses
+			}
+		}
+	}
+
+	for candidate, rcode := range c.RCodes {
+		if sameName(candidate, name) {
+			return append(responses, newResponse(header, questions, rcode, nil))
+		}
+	}
+
+	for candidate, addrs := range c.Records {
+		if sameName(candidate, name) {
+			return append(responses, newResponse(header, questions, dnsmessage.RCodeSuccess,
+				newAnswers(question, addrs)))
+		}
+	}
+
+	return append(responses, newResponse(header, questions, dnsmessage.RCodeNameError, nil))
+}
+
+// newAnswers returns the answers to the question using the given addresses.
+func newAnswers(question dnsmessage.Question, addrs []netip.Addr) []dnsmessage.Resource {
+	var answers []dnsmessage.Resource
+	for _, addr := range addrs {
+		header := dnsmessage.ResourceHeader{
+			Name:  question.Name,
+			Type:  question.Type,
+			Class: dnsmessage.ClassINET,
+			TTL:   60,
+		}
+		addr = addr.Unmap()
+		switch {
+		case addr.Is4() && question.Type == dnsmessage.TypeA:
+			answers = append(answers, dnsmessage.Resource{
+				Header: header,
+				Body:   &dnsmessage.AResource{A: addr.As4()},
+			})
+		case addr.Is6() && question.Type == dnsmessage.TypeAAAA:
+			answers = append(answers, dnsmessage.Resource{
+				Header: header,
+				Body:   &dnsmessage.AAAAResource{AAAA: addr.As16()},
+			})
+		}
+	}
+	return answers
+}
+
+// newResponse creates a raw response to the query with the given header and questions.
+func newResponse(query dnsmessage.Header, questions []dnsmessage.Question,
+	rcode dnsmessage.RCode, answers []dnsmessage.Resource) []byte {
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 query.ID,
+			Response:           true,
+			OpCode:             query.OpCode,
+			Authoritative:      true,
+			RecursionDesired:   query.RecursionDesired,
+			RecursionAvailable: true,
+			RCode:              rcode,
+		},
+		Questions: questions,
+		Answers:   answers,
+	}
+	return runtimex.Try1(msg.Pack())
+}
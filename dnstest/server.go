@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package dnstest implements an in-process DNS server for tests.
+//
+// Use [NewServer] with a [*Config] containing zone records, names for which
+// to return NXDOMAIN, SERVFAIL, or other response codes, names for which we
+// time out, and spoofed responses. The [*Server] listens on the loopback
+// interface using UDP and TCP and also implements [http.Handler] to serve
+// DNS-over-HTTPS, e.g., using [net/http/httptest.NewTLSServer].
+//
+// The [*Server] allows tests to be hermetic and DNS behavior to be
+// deterministic. For example, use [NewConfigExampleCom] along with
+// [github.com/rbmk-project/common/selfsignedcert.NewConfigExampleCom] to
+// test TLS connections to example.com without depending on the network.
+//
+// Use the Dial method with a [*net.Resolver] to test how the standard
+// library resolves names and how [errclass.New] classifies its errors:
+//
+//	reso := &net.Resolver{PreferGo: true, Dial: srv.Dial}
+package dnstest
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/rbmk-project/common/runtimex"
+)
+
+// Server is an in-process DNS server.
+//
+// Construct using [NewServer].
+type Server struct {
+	// TCPAddr is the address of the TCP listener.
+	TCPAddr string
+
+	// UDPAddr is the address of the UDP listener.
+	UDPAddr string
+
+	// config is the server configuration.
+	config *Config
+
+	// done is closed by Close to unblock the timed out queries.
+	done chan struct{}
+
+	// listener is the TCP listener.
+	listener net.Listener
+
+	// closeOnce ensures Close is idempotent.
+	closeOnce sync.Once
+
+	// pconn is the UDP socket.
+	pconn net.PacketConn
+
+	// wg allows to wait for the background goroutines.
+	wg sync.WaitGroup
+}
+
+// NewServer creates and starts a new [*Server] using the given [*Config],
+// which we do not copy, so don't modify it while the server is running.
+//
+// This function panics on failure.
+func NewServer(config *Config) *Server {
+	srv := &Server{
+		config:   config,
+		done:     make(chan struct{}),
+		listener: runtimex.Try1(net.Listen("tcp", "127.0.0.1:0")),
+		pconn:    runtimex.Try1(net.ListenPacket("udp", "127.0.0.1:0")),
+	}
+	srv.TCPAddr = srv.listener.Addr().String()
+	srv.UDPAddr = srv.pconn.LocalAddr().String()
+	srv.wg.Add(2)
+	go srv.serveUDP()
+	go srv.serveTCP()
+	return srv
+}
+
+// Close stops the server and waits for the background goroutines to terminate.
+func (srv *Server) Close() error {
+	srv.closeOnce.Do(func() {
+		close(srv.done)
+		srv.listener.Close()
+		srv.pconn.Close()
+	})
+	srv.wg.Wait()
+	return nil
+}
+
+// Dial dials a connection with the server ignoring the given address, which
+// makes this method suitable as the Dial field of a [*net.Resolver]. We
+// use the UDP listener for "udp" networks and the TCP listener otherwise.
+func (srv *Server) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+		return (&net.Dialer{}).DialContext(ctx, "udp", srv.UDPAddr)
+	default:
+		return (&net.Dialer{}).DialContext(ctx, "tcp", srv.TCPAddr)
+	}
+}
+
+// serveUDP serves DNS-over-UDP.
+func (srv *Server) serveUDP() {
+	defer srv.wg.Done()
+	buffer := make([]byte, 65535)
+	for {
+		count, addr, err := srv.pconn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		for _, rawResp := range srv.config.respond(buffer[:count], true) {
+			srv.pconn.WriteTo(rawResp, addr)
+		}
+	}
+}
+
+// serveTCP serves DNS-over-TCP.
+func (srv *Server) serveTCP() {
+	defer srv.wg.Done()
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			return
+		}
+		srv.wg.Add(1)
+		go srv.serveConn(conn)
+	}
+}
+
+// serveConn serves the queries sent over a TCP connection.
+func (srv *Server) serveConn(conn net.Conn) {
+	defer srv.wg.Done()
+	defer conn.Close()
+
+	// make sure we interrupt any pending I/O when closing
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-srv.done:
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		rawQuery := make([]byte, binary.BigEndian.Uint16(header))
+		if _, err := io.ReadFull(conn, rawQuery); err != nil {
+			return
+		}
+		for _, rawResp := range srv.config.respond(rawQuery, false) {
+			frame := binary.BigEndian.AppendUint16(nil, uint16(len(rawResp)))
+			if _, err := conn.Write(append(frame, rawResp...)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// dnsMessageContentType is the content type defined by RFC 8484.
+const dnsMessageContentType = "application/dns-message"
+
+// ServeHTTP implements [http.Handler] to serve DNS-over-HTTPS (RFC 8484)
+// queries sent using the POST method.
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.Header.Get("Content-Type") != dnsMessageContentType {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rawQuery, err := io.ReadAll(io.LimitReader(r.Body, 65535))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	responses := srv.config.respond(rawQuery, false)
+	if len(responses) <= 0 {
+		select {
+		case <-r.Context().Done():
+		case <-srv.done:
+		}
+		w.WriteHeader(http.StatusGatewayTimeout)
+		return
+	}
+	w.Header().Set("Content-Type", dnsMessageContentType)
+	w.Write(responses[0])
+}
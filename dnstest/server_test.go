@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnstest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/rbmk-project/common/dnsresolver"
+	"github.com/rbmk-project/common/errclass"
+	"github.com/rbmk-project/common/happyeyeballs"
+	"github.com/rbmk-project/common/runtimex"
+	"github.com/rbmk-project/common/selfsignedcert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newTestConfig creates the [*Config] used by most tests.
+func newTestConfig() *Config {
+	config := NewConfigExampleCom()
+	config.Records["v4only.example"] = []netip.Addr{netip.MustParseAddr("192.0.2.1")}
+	config.RCodes["servfail.example"] = dnsmessage.RCodeServerFailure
+	config.RCodes["refused.example"] = dnsmessage.RCodeRefused
+	config.Spoofed["spoofed.example"] = []netip.Addr{netip.MustParseAddr("10.10.34.35")}
+	config.Records["spoofed.example"] = []netip.Addr{netip.MustParseAddr("192.0.2.2")}
+	config.Timeouts = []string{"timeout.example"}
+	return config
+}
+
+func TestServerWithStdlibResolver(t *testing.T) {
+	srv := NewServer(newTestConfig())
+	defer srv.Close()
+	reso := &net.Resolver{PreferGo: true, Dial: srv.Dial}
+
+	tests := []struct {
+		name     string
+		network  string
+		host     string
+		expect   []string
+		errClass string
+	}{
+		{"records", "ip", "WWW.example.com.", []string{"127.0.0.1", "::1"}, ""},
+		{"NODATA", "ip6", "v4only.example", nil, errclass.EDNS_NONAME},
+		{"NXDOMAIN", "ip", "nxdomain.example", nil, errclass.EDNS_NONAME},
+		{"SERVFAIL", "ip4", "servfail.example", nil, errclass.EDNS_SERVFAIL},
+		{"timeout", "ip4", "timeout.example", nil, errclass.ETIMEDOUT},
+		{"spoofed", "ip4", "spoofed.example", []string{"10.10.34.35"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+			addrs, err := reso.LookupNetIP(ctx, tt.network, tt.host)
+			assert.Equal(t, tt.errClass, errclass.New(err))
+			var got []string
+			for _, addr := range addrs {
+				got = append(got, addr.String())
+			}
+			assert.ElementsMatch(t, tt.expect, got)
+		})
+	}
+}
+
+func TestServerWithDNSResolver(t *testing.T) {
+	srv := NewServer(newTestConfig())
+	defer srv.Close()
+	httpsServer := httptest.NewTLSServer(srv)
+	defer httpsServer.Close()
+
+	transports := []dnsresolver.Transport{
+		dnsresolver.NewUDPTransport(srv.UDPAddr),
+		dnsresolver.NewTCPTransport(srv.TCPAddr),
+		dnsresolver.NewHTTPSTransport(httpsServer.Client(), httpsServer.URL),
+	}
+
+	tests := []struct {
+		name     string
+		network  string
+		host     string
+		errClass string
+	}{
+		{"records", "ip", "example.com", ""},
+		{"NODATA", "ip6", "v4only.example", errclass.EDNS_NODATA},
+		{"NXDOMAIN", "ip", "nxdomain.example", errclass.EDNS_NONAME},
+		{"SERVFAIL", "ip4", "servfail.example", errclass.EDNS_SERVFAIL},
+		{"REFUSED", "ip4", "refused.example", errclass.EDNS_REFUSED},
+		{"timeout", "ip4", "timeout.example", errclass.ETIMEDOUT},
+	}
+
+	for _, txp := range transports {
+		for _, tt := range tests {
+			t.Run(txp.Protocol()+"/"+tt.name, func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				reso := dnsresolver.NewResolver(txp, nil)
+				_, err := reso.LookupNetIP(ctx, tt.network, tt.host)
+				assert.Equal(t, tt.errClass, errclass.New(err))
+			})
+		}
+	}
+}
+
+func TestServerSpoofing(t *testing.T) {
+	srv := NewServer(newTestConfig())
+	defer srv.Close()
+	question := dnsmessage.Question{
+		Name:  dnsmessage.MustNewName("spoofed.example."),
+		Type:  dnsmessage.TypeA,
+		Class: dnsmessage.ClassINET,
+	}
+	query := dnsmessage.Message{Header: dnsmessage.Header{ID: 17}, Questions: []dnsmessage.Question{question}}
+	rawQuery := runtimex.Try1(query.Pack())
+
+	// parseAddr parses the raw response and returns the single A record.
+	parseAddr := func(rawResp []byte) string {
+		var resp dnsmessage.Message
+		require.NoError(t, resp.Unpack(rawResp))
+		assert.Equal(t, uint16(17), resp.ID)
+		require.Len(t, resp.Answers, 1)
+		return netip.AddrFrom4(resp.Answers[0].Body.(*dnsmessage.AResource).A).String()
+	}
+
+	t.Run("UDP receives both responses", func(t *testing.T) {
+		conn, err := srv.Dial(context.Background(), "udp", "")
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write(rawQuery)
+		require.NoError(t, err)
+
+		var got []string
+		buffer := make([]byte, 1024)
+		for len(got) < 2 {
+			count, err := conn.Read(buffer)
+			require.NoError(t, err)
+			got = append(got, parseAddr(buffer[:count]))
+		}
+		assert.Equal(t, []string{"10.10.34.35", "192.0.2.2"}, got)
+	})
+
+	t.Run("TCP only receives the spoofed response", func(t *testing.T) {
+		reso := dnsresolver.NewResolver(dnsresolver.NewTCPTransport(srv.TCPAddr), nil)
+		addrs, err := reso.LookupNetIP(context.Background(), "ip4", "spoofed.example")
+		require.NoError(t, err)
+		assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.10.34.35")}, addrs)
+	})
+}
+
+func TestServerMalformedQueries(t *testing.T) {
+	config := NewConfig()
+
+	t.Run("we ignore garbage and responses", func(t *testing.T) {
+		assert.Empty(t, config.respond([]byte{1}, true))
+		resp := dnsmessage.Message{Header: dnsmessage.Header{ID: 1, Response: true}}
+		assert.Empty(t, config.respond(runtimex.Try1(resp.Pack()), true))
+	})
+
+	t.Run("we return FORMERR without a single question", func(t *testing.T) {
+		query := dnsmessage.Message{Header: dnsmessage.Header{ID: 1}}
+		responses := config.respond(runtimex.Try1(query.Pack()), true)
+		require.Len(t, responses, 1)
+		var resp dnsmessage.Message
+		require.NoError(t, resp.Unpack(responses[0]))
+		assert.Equal(t, dnsmessage.RCodeFormatError, resp.RCode)
+	})
+
+	t.Run("we reject invalid DNS-over-HTTPS requests", func(t *testing.T) {
+		srv := NewServer(config)
+		defer srv.Close()
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestServerCloseUnblocksTimeouts(t *testing.T) {
+	srv := NewServer(newTestConfig())
+	reso := dnsresolver.NewResolver(dnsresolver.NewTCPTransport(srv.TCPAddr), nil)
+	done := make(chan error)
+	go func() {
+		_, err := reso.LookupNetIP(context.Background(), "ip4", "timeout.example")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, srv.Close())
+	assert.Error(t, <-done)
+	require.NoError(t, srv.Close()) // idempotent
+}
+
+func TestServerWithSelfSignedCert(t *testing.T) {
+	// Create the DNS server and a TLS server for example.com.
+	dnsServer := NewServer(NewConfigExampleCom())
+	defer dnsServer.Close()
+
+	cert := selfsignedcert.New(selfsignedcert.NewConfigExampleCom())
+	tlsCert := runtimex.Try1(tls.X509KeyPair(cert.CertPEM, cert.KeyPEM))
+	httpServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Bonsoir, Elliot!\n"))
+	}))
+	httpServer.TLS = &tls.Config{Certificates: []tls.Certificate{tlsCert}}
+	httpServer.StartTLS()
+	defer httpServer.Close()
+	_, port := runtimex.Try2(net.SplitHostPort(httpServer.Listener.Addr().String()))
+
+	// Create an HTTP client resolving names using the DNS server.
+	dialer := happyeyeballs.NewDialer(nil)
+	dialer.LookupNetIP = dnsresolver.NewResolver(dnsresolver.NewUDPTransport(dnsServer.UDPAddr), nil).LookupNetIP
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(cert.CertPEM))
+	client := &http.Client{Transport: &http.Transport{
+		DialContext:     dialer.DialContext,
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get("https://www.example.com:" + port + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -18,7 +18,7 @@ with names resembling standard Unix error names.
 
 5. Follow Unix-like naming where appropriate.
 
-6. Prefix subsystem-specific errors (`EDNS_`, `ETLS_`).
+6. Prefix subsystem-specific errors (`EDNS_`, `ETLS_`, `EQUIC_`).
 
 7. Keep full names for clarity over brevity.
 
@@ -32,7 +32,7 @@ with names resembling standard Unix error names.
 
 - [EEOF] for (unexpected) [io.EOF] and [io.ErrUnexpectedEOF] errors
 
-- [ECONNRESET], [ECONNREFUSED], ... for respective syscall errors
+- [ECONNRESET], [ECONNREFUSED], [EPIPE], [EMFILE], ... for respective syscall errors
 
 The actual system error constants are defined in platform-specific files:
 
@@ -49,6 +49,10 @@ platform-specific error constants.
 
 - [EDNS_NODATA] for errors with the "no answer" suffix
 
+- [EDNS_SERVFAIL] for errors with the "server misbehaving" suffix
+
+- [EDNS_REFUSED] for errors with the "query refused" suffix
+
 # TLS
 
 - [ETLS_HOSTNAME_MISMATCH] for hostname verification failure
@@ -57,9 +61,49 @@ platform-specific error constants.
 
 - [ETLS_CERT_INVALID] for invalid certificate
 
+# QUIC
+
+To avoid depending on a specific QUIC library, we detect QUIC errors using
+interfaces that errors in the chain should implement. Code using a QUIC
+library should wrap its errors with types implementing these interfaces:
+
+- [EQUIC_HANDSHAKE_TIMEOUT] for [QUICHandshakeTimeoutError]
+
+- [EQUIC_IDLE_TIMEOUT] for [QUICIdleTimeoutError]
+
+- [EQUIC_STATELESS_RESET] for [QUICStatelessResetError]
+
+- [EQUIC_VERSION_NEGOTIATION] for [QUICVersionNegotiationError]
+
+- [EQUIC_CRYPTO_ERROR] for [QUICTransportError] with a CRYPTO_ERROR code
+
+- [EQUIC_TRANSPORT_ERROR] for other [QUICTransportError]
+
+- [EQUIC_APPLICATION_ERROR] for [QUICApplicationError]
+
+Use [QUICTLSAlert] to extract the TLS alert embedded in a CRYPTO_ERROR.
+
 # Fallback
 
 - [EGENERIC] for unclassified errors
+
+# Structured Metadata
+
+[NewInfo] returns an [*Info] containing the error class along with the
+network layer that failed, whether the error is a timeout, whether it
+is temporary or retryable, and the underlying system error number.
+
+# Logging
+
+[NewHandler] wraps a [slog.Handler] to automatically add the `errClass`
+field (or, more generally, `<key>Class`) next to any logged error.
+
+# OONI Compatibility
+
+[ToOONIFailure] and [FromOONIFailure] convert between classes, given the
+operation that failed (e.g., [OpConnect]), and OONI failure strings such as
+`connection_reset` or `dns_nxdomain_error`. [NewOONIFailure] classifies an
+error and directly returns the corresponding OONI failure string.
 */
 package errclass
 
@@ -68,6 +112,7 @@ import (
 	"crypto/x509"
 	"errors"
 	"io"
+	"maps"
 	"net"
 	"os"
 	"strings"
@@ -78,12 +123,18 @@ const (
 	// Errors that we can map using [errors.Is]:
 	//
 
+	// EACCES is the permission denied error.
+	EACCES = "EACCES"
+
 	// EADDRNOTAVAIL is the address not available error.
 	EADDRNOTAVAIL = "EADDRNOTAVAIL"
 
 	// EADDRINUSE is the address in use error.
 	EADDRINUSE = "EADDRINUSE"
 
+	// EAFNOSUPPORT is the address family not supported error.
+	EAFNOSUPPORT = "EAFNOSUPPORT"
+
 	// ECONNABORTED is the connection aborted error.
 	ECONNABORTED = "ECONNABORTED"
 
@@ -105,18 +156,39 @@ const (
 	// EINTR is the interrupted system call error.
 	EINTR = "EINTR"
 
+	// EMFILE is the too many open files error.
+	EMFILE = "EMFILE"
+
+	// EMSGSIZE is the message too long error.
+	EMSGSIZE = "EMSGSIZE"
+
 	// ENETDOWN is the network is down error.
 	ENETDOWN = "ENETDOWN"
 
+	// ENETRESET is the connection reset by network error.
+	ENETRESET = "ENETRESET"
+
 	// ENETUNREACH is the network unreachable error.
 	ENETUNREACH = "ENETUNREACH"
 
+	// ENFILE is the too many open files in system error.
+	ENFILE = "ENFILE"
+
 	// ENOBUFS is the no buffer space available error.
 	ENOBUFS = "ENOBUFS"
 
+	// ENOENT is the no such file or directory error.
+	ENOENT = "ENOENT"
+
 	// ENOTCONN is the not connected error.
 	ENOTCONN = "ENOTCONN"
 
+	// EPERM is the operation not permitted error.
+	EPERM = "EPERM"
+
+	// EPIPE is the broken pipe error.
+	EPIPE = "EPIPE"
+
 	// EPROTONOSUPPORT is the protocol not supported error.
 	EPROTONOSUPPORT = "EPROTONOSUPPORT"
 
@@ -133,6 +205,12 @@ const (
 	// EDNS_NODATA 	is the DNS error for "no answer".
 	EDNS_NODATA = "EDNS_NODATA"
 
+	// EDNS_SERVFAIL is the DNS error for "server misbehaving".
+	EDNS_SERVFAIL = "EDNS_SERVFAIL"
+
+	// EDNS_REFUSED is the DNS error for "query refused".
+	EDNS_REFUSED = "EDNS_REFUSED"
+
 	//
 	// Errors that we can map using [errors.As]:
 	//
@@ -146,6 +224,31 @@ const (
 	// ETLS_CERT_INVALID is the TLS error for invalid certificate.
 	ETLS_CERT_INVALID = "ETLS_CERT_INVALID"
 
+	//
+	// Errors that we can map using the QUIC detection interfaces:
+	//
+
+	// EQUIC_HANDSHAKE_TIMEOUT is the QUIC error for handshake timeout.
+	EQUIC_HANDSHAKE_TIMEOUT = "EQUIC_HANDSHAKE_TIMEOUT"
+
+	// EQUIC_IDLE_TIMEOUT is the QUIC error for idle timeout.
+	EQUIC_IDLE_TIMEOUT = "EQUIC_IDLE_TIMEOUT"
+
+	// EQUIC_STATELESS_RESET is the QUIC error for receiving a stateless reset.
+	EQUIC_STATELESS_RESET = "EQUIC_STATELESS_RESET"
+
+	// EQUIC_VERSION_NEGOTIATION is the QUIC error for version negotiation failure.
+	EQUIC_VERSION_NEGOTIATION = "EQUIC_VERSION_NEGOTIATION"
+
+	// EQUIC_CRYPTO_ERROR is the QUIC error for CRYPTO_ERROR transport errors.
+	EQUIC_CRYPTO_ERROR = "EQUIC_CRYPTO_ERROR"
+
+	// EQUIC_TRANSPORT_ERROR is the QUIC error for other transport errors.
+	EQUIC_TRANSPORT_ERROR = "EQUIC_TRANSPORT_ERROR"
+
+	// EQUIC_APPLICATION_ERROR is the QUIC error for application errors.
+	EQUIC_APPLICATION_ERROR = "EQUIC_APPLICATION_ERROR"
+
 	//
 	// Fallback errors:
 	//
@@ -158,8 +261,10 @@ const (
 var errorsIsMap = map[error]string{
 	context.DeadlineExceeded: ETIMEDOUT,
 	context.Canceled:         EINTR,
+	errEACCES:                EACCES,
 	errEADDRNOTAVAIL:         EADDRNOTAVAIL,
 	errEADDRINUSE:            EADDRINUSE,
+	errEAFNOSUPPORT:          EAFNOSUPPORT,
 	errECONNABORTED:          ECONNABORTED,
 	errECONNREFUSED:          ECONNREFUSED,
 	errECONNRESET:            ECONNRESET,
@@ -168,20 +273,32 @@ var errorsIsMap = map[error]string{
 	io.ErrUnexpectedEOF:      EEOF,
 	errEINVAL:                EINVAL,
 	errEINTR:                 EINTR,
+	errEMFILE:                EMFILE,
+	errEMSGSIZE:              EMSGSIZE,
 	errENETDOWN:              ENETDOWN,
+	errENETRESET:             ENETRESET,
 	errENETUNREACH:           ENETUNREACH,
 	errENOBUFS:               ENOBUFS,
+	errENOENT:                ENOENT,
 	errENOTCONN:              ENOTCONN,
+	errEPIPE:                 EPIPE,
 	errEPROTONOSUPPORT:       EPROTONOSUPPORT,
 	errETIMEDOUT:             ETIMEDOUT,
 	net.ErrClosed:            EINTR,
 	os.ErrDeadlineExceeded:   ETIMEDOUT,
 }
 
+func init() {
+	// add the errors whose mapping depends on the platform
+	maps.Copy(errorsIsMap, errorsIsPlatformMap)
+}
+
 // stringSuffixMap contains the errors that we can map using the error message suffix.
 var stringSuffixMap = map[string]string{
 	"no answer from DNS server": EDNS_NODATA,
 	"no such host":              EDNS_NONAME,
+	"query refused":             EDNS_REFUSED,
+	"server misbehaving":        EDNS_SERVFAIL,
 }
 
 // errorsAsList contains the errors that we can map with [errors.As].
@@ -221,6 +338,13 @@ func New(err error) string {
 		return ""
 	}
 
+	// attempt mapping QUIC errors using the [errors.As] func
+	for _, entry := range quicErrorsAsList {
+		if entry.as(err) {
+			return entry.class
+		}
+	}
+
 	// attemp direct mapping using the [errors.Is] func
 	for candidate, class := range errorsIsMap {
 		if errors.Is(err, candidate) {
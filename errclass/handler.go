@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package errclass
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+)
+
+// Handler is a [slog.Handler] middleware that inspects each record and, for
+// each attribute holding an error, adds a sibling attribute named after the
+// original key with the `Class` suffix containing the result of [New].
+//
+// For example, `slog.Any("err", err)` causes the handler to also emit
+// `errClass`. If the record or the attributes added using WithAttrs in the
+// same group already contain the sibling attribute (e.g., because the caller
+// explicitly added `errClass`), we do not add it again.
+//
+// Construct using [NewHandler].
+type Handler struct {
+	// keys contains the keys added using WithAttrs in the current group.
+	keys map[string]bool
+
+	// next is the wrapped [slog.Handler].
+	next slog.Handler
+}
+
+var _ slog.Handler = &Handler{}
+
+// NewHandler creates a new [*Handler] wrapping the given [slog.Handler].
+func NewHandler(next slog.Handler) *Handler {
+	return &Handler{next: next}
+}
+
+// Enabled implements [slog.Handler].
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements [slog.Handler].
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	// collect the record attributes
+	attrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+
+	// avoid copying the record when there are no errors
+	attrs, changed := classifyAttrs(attrs, h.keys)
+	if !changed {
+		return h.next.Handle(ctx, record)
+	}
+
+	// build a new record containing the additional attributes
+	newRecord := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	newRecord.AddAttrs(attrs...)
+	return h.next.Handle(ctx, newRecord)
+}
+
+// WithAttrs implements [slog.Handler].
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	attrs, _ = classifyAttrs(attrs, h.keys)
+	keys := maps.Clone(h.keys)
+	if keys == nil {
+		keys = make(map[string]bool, len(attrs))
+	}
+	for _, attr := range attrs {
+		keys[attr.Key] = true
+	}
+	return &Handler{keys: keys, next: h.next.WithAttrs(attrs)}
+}
+
+// WithGroup implements [slog.Handler].
+func (h *Handler) WithGroup(name string) slog.Handler {
+	// the following attributes belong to the group, so they
+	// cannot clash with the keys added before the group
+	return &Handler{next: h.next.WithGroup(name)}
+}
+
+// classifyAttrs returns the attributes with an additional `<key>Class`
+// attribute following each attribute holding a non-nil error, and
+// whether it added any attribute. We descend into groups. The existing
+// keys are the keys already present alongside the attributes.
+func classifyAttrs(attrs []slog.Attr, existing map[string]bool) ([]slog.Attr, bool) {
+	// remember the existing keys to avoid adding duplicates
+	keys := maps.Clone(existing)
+	if keys == nil {
+		keys = make(map[string]bool, len(attrs))
+	}
+	for _, attr := range attrs {
+		keys[attr.Key] = true
+	}
+
+	var (
+		changed bool
+		output  = make([]slog.Attr, 0, len(attrs))
+	)
+	for _, attr := range attrs {
+		attr.Value = attr.Value.Resolve()
+
+		switch attr.Value.Kind() {
+		case slog.KindGroup:
+			group, groupChanged := classifyAttrs(attr.Value.Group(), nil)
+			if groupChanged {
+				attr = slog.Attr{Key: attr.Key, Value: slog.GroupValue(group...)}
+				changed = true
+			}
+			output = append(output, attr)
+
+		case slog.KindAny:
+			output = append(output, attr)
+			err, ok := attr.Value.Any().(error)
+			classKey := attr.Key + "Class"
+			if !ok || err == nil || keys[classKey] {
+				continue
+			}
+			output = append(output, slog.String(classKey, New(err)))
+			keys[classKey] = true
+			changed = true
+
+		default:
+			output = append(output, attr)
+		}
+	}
+	return output, changed
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package errclass
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	// newLogger creates a logger writing JSON without timestamps into w.
+	newLogger := func(w *bytes.Buffer) *slog.Logger {
+		return slog.New(NewHandler(slog.NewJSONHandler(w, &slog.HandlerOptions{
+			ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+				if attr.Key == slog.TimeKey && len(groups) == 0 {
+					return slog.Attr{}
+				}
+				return attr
+			},
+		})))
+	}
+
+	tests := []struct {
+		name      string
+		log       func(logger *slog.Logger)
+		expectLog string
+	}{
+		{
+			name: "record without errors",
+			log: func(logger *slog.Logger) {
+				logger.Info("event", slog.String("key", "value"))
+			},
+			expectLog: `{"level":"INFO","msg":"event","key":"value"}` + "\n",
+		},
+
+		{
+			name: "record with an error",
+			log: func(logger *slog.Logger) {
+				logger.Info("event", slog.Any("err", context.DeadlineExceeded))
+			},
+			expectLog: `{"level":"INFO","msg":"event","err":"context deadline exceeded",` +
+				`"errClass":"ETIMEDOUT"}` + "\n",
+		},
+
+		{
+			name: "record with multiple errors",
+			log: func(logger *slog.Logger) {
+				logger.Info(
+					"event",
+					slog.Any("readErr", context.Canceled),
+					slog.Any("closeErr", errors.New("mocked error")),
+				)
+			},
+			expectLog: `{"level":"INFO","msg":"event","readErr":"context canceled",` +
+				`"readErrClass":"EINTR","closeErr":"mocked error","closeErrClass":"EGENERIC"}` + "\n",
+		},
+
+		{
+			name: "record with a nil error",
+			log: func(logger *slog.Logger) {
+				var err error
+				logger.Info("event", slog.Any("err", err))
+			},
+			expectLog: `{"level":"INFO","msg":"event","err":null}` + "\n",
+		},
+
+		{
+			name: "record already containing the class",
+			log: func(logger *slog.Logger) {
+				logger.Info(
+					"event",
+					slog.Any("err", context.DeadlineExceeded),
+					slog.String("errClass", "ECUSTOM"),
+				)
+			},
+			expectLog: `{"level":"INFO","msg":"event","err":"context deadline exceeded",` +
+				`"errClass":"ECUSTOM"}` + "\n",
+		},
+
+		{
+			name: "record with an error inside a group",
+			log: func(logger *slog.Logger) {
+				logger.Info("event", slog.Group("conn", slog.Any("err", context.Canceled)))
+			},
+			expectLog: `{"level":"INFO","msg":"event","conn":{"err":"context canceled",` +
+				`"errClass":"EINTR"}}` + "\n",
+		},
+
+		{
+			name: "logger with an error attribute",
+			log: func(logger *slog.Logger) {
+				logger.With(slog.Any("err", context.Canceled)).WithGroup("g").Info("event")
+			},
+			expectLog: `{"level":"INFO","msg":"event","err":"context canceled",` +
+				`"errClass":"EINTR"}` + "\n",
+		},
+
+		{
+			name: "logger already containing the class",
+			log: func(logger *slog.Logger) {
+				logger.With(slog.String("errClass", "ECUSTOM")).Info("event", slog.Any("err", context.Canceled))
+			},
+			expectLog: `{"level":"INFO","msg":"event","errClass":"ECUSTOM",` +
+				`"err":"context canceled"}` + "\n",
+		},
+
+		{
+			name: "logger containing the class outside of the group",
+			log: func(logger *slog.Logger) {
+				logger.With(slog.String("errClass", "ECUSTOM")).WithGroup("g").Info(
+					"event", slog.Any("err", context.Canceled))
+			},
+			expectLog: `{"level":"INFO","msg":"event","errClass":"ECUSTOM",` +
+				`"g":{"err":"context canceled","errClass":"EINTR"}}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			tt.log(newLogger(&out))
+			assert.Equal(t, tt.expectLog, out.String())
+		})
+	}
+
+	t.Run("Enabled", func(t *testing.T) {
+		handler := NewHandler(slog.NewJSONHandler(&bytes.Buffer{}, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+		assert.False(t, handler.Enabled(context.Background(), slog.LevelDebug))
+		assert.True(t, handler.Enabled(context.Background(), slog.LevelInfo))
+	})
+}
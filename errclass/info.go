@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package errclass
+
+import (
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+const (
+	// LayerDNS indicates a failure during name resolution.
+	LayerDNS = "dns"
+
+	// LayerTCP indicates a failure at the TCP transport layer.
+	LayerTCP = "tcp"
+
+	// LayerUDP indicates a failure at the UDP transport layer.
+	LayerUDP = "udp"
+
+	// LayerTLS indicates a failure during the TLS handshake or TLS I/O.
+	LayerTLS = "tls"
+
+	// LayerHTTP indicates a failure surfaced by the HTTP client
+	// for which we could not identify a lower layer.
+	LayerHTTP = "http"
+
+	// LayerQUIC indicates a failure at the QUIC transport layer.
+	LayerQUIC = "quic"
+)
+
+// Info contains structured metadata about a classified error.
+//
+// Construct using [NewInfo].
+type Info struct {
+	// Class is the error class as returned by [New].
+	Class string
+
+	// Layer is the network layer that failed (e.g., [LayerTCP]) or
+	// an empty string when we cannot determine the layer.
+	Layer string
+
+	// Timeout indicates whether the error is a timeout.
+	Timeout bool
+
+	// Temporary indicates whether the error is likely caused by
+	// a transient condition that may go away on its own.
+	Temporary bool
+
+	// Retryable indicates whether it makes sense to retry the
+	// same operation after this error occurred.
+	Retryable bool
+
+	// Errno is the underlying system error number or zero
+	// when the error does not wrap a [syscall.Errno].
+	Errno syscall.Errno
+}
+
+// classProps contains the static properties of an error class.
+type classProps struct {
+	layer     string
+	timeout   bool
+	temporary bool
+	retryable bool
+}
+
+// classPropsMap maps each error class to its static properties.
+//
+// Classes not listed here are neither timeouts, temporary, nor
+// retryable and have no default layer.
+var classPropsMap = map[string]classProps{
+	EACCES:                    {layer: "", temporary: false, retryable: false},
+	EADDRNOTAVAIL:             {layer: "", temporary: false, retryable: false},
+	EADDRINUSE:                {layer: "", temporary: true, retryable: true},
+	EAFNOSUPPORT:              {layer: "", temporary: false, retryable: false},
+	ECONNABORTED:              {layer: LayerTCP, temporary: true, retryable: true},
+	ECONNREFUSED:              {layer: LayerTCP, temporary: false, retryable: true},
+	ECONNRESET:                {layer: LayerTCP, temporary: true, retryable: true},
+	EHOSTUNREACH:              {layer: "", temporary: true, retryable: true},
+	EEOF:                      {layer: "", temporary: true, retryable: true},
+	EINVAL:                    {layer: "", temporary: false, retryable: false},
+	EINTR:                     {layer: "", temporary: false, retryable: false},
+	EMFILE:                    {layer: "", temporary: true, retryable: true},
+	EMSGSIZE:                  {layer: "", temporary: false, retryable: false},
+	ENETDOWN:                  {layer: "", temporary: true, retryable: true},
+	ENETRESET:                 {layer: "", temporary: true, retryable: true},
+	ENETUNREACH:               {layer: "", temporary: true, retryable: true},
+	ENFILE:                    {layer: "", temporary: true, retryable: true},
+	ENOBUFS:                   {layer: "", temporary: true, retryable: true},
+	ENOENT:                    {layer: "", temporary: false, retryable: false},
+	ENOTCONN:                  {layer: "", temporary: false, retryable: false},
+	EPERM:                     {layer: "", temporary: false, retryable: false},
+	EPIPE:                     {layer: "", temporary: false, retryable: true},
+	EPROTONOSUPPORT:           {layer: "", temporary: false, retryable: false},
+	ETIMEDOUT:                 {layer: "", timeout: true, temporary: true, retryable: true},
+	EDNS_NONAME:               {layer: LayerDNS, temporary: false, retryable: false},
+	EDNS_NODATA:               {layer: LayerDNS, temporary: false, retryable: false},
+	EDNS_SERVFAIL:             {layer: LayerDNS, temporary: true, retryable: true},
+	EDNS_REFUSED:              {layer: LayerDNS, temporary: false, retryable: true},
+	ETLS_HOSTNAME_MISMATCH:    {layer: LayerTLS, temporary: false, retryable: false},
+	ETLS_CA_UNKNOWN:           {layer: LayerTLS, temporary: false, retryable: false},
+	ETLS_CERT_INVALID:         {layer: LayerTLS, temporary: false, retryable: false},
+	EQUIC_HANDSHAKE_TIMEOUT:   {layer: LayerQUIC, timeout: true, temporary: true, retryable: true},
+	EQUIC_IDLE_TIMEOUT:        {layer: LayerQUIC, timeout: true, temporary: true, retryable: true},
+	EQUIC_STATELESS_RESET:     {layer: LayerQUIC, temporary: true, retryable: true},
+	EQUIC_VERSION_NEGOTIATION: {layer: LayerQUIC, temporary: false, retryable: false},
+	EQUIC_CRYPTO_ERROR:        {layer: LayerQUIC, temporary: false, retryable: false},
+	EQUIC_TRANSPORT_ERROR:     {layer: LayerQUIC, temporary: false, retryable: false},
+	EQUIC_APPLICATION_ERROR:   {layer: LayerQUIC, temporary: false, retryable: false},
+	EGENERIC:                  {layer: "", temporary: false, retryable: false},
+}
+
+// NewInfo creates a new [*Info] from the given error.
+//
+// The nil error maps to a zero-initialized [*Info].
+func NewInfo(err error) *Info {
+	// exclude the nil error case first
+	if err == nil {
+		return &Info{}
+	}
+
+	// start from the error class and its static properties
+	class := New(err)
+	props := classPropsMap[class]
+	info := &Info{
+		Class:     class,
+		Layer:     props.layer,
+		Timeout:   props.timeout,
+		Temporary: props.temporary,
+		Retryable: props.retryable,
+	}
+
+	// refine the timeout using the [net.Error] interface, which also covers
+	// the [*net.DNSError] timeouts that [New] classifies as [EGENERIC],
+	// and treat timeouts as temporary and retryable like [ETIMEDOUT]
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		info.Timeout = true
+		info.Temporary = true
+		info.Retryable = true
+	}
+
+	// extract the underlying system error number
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		info.Errno = errno
+	}
+
+	// determine the layer from the error chain unless the class belongs to
+	// the QUIC layer, which is more specific than the UDP layer of the
+	// [*net.OpError] wrapping QUIC errors
+	if info.Layer != LayerQUIC {
+		if layer := layerFromChain(err); layer != "" {
+			info.Layer = layer
+		}
+	}
+	return info
+}
+
+// layerFromChain inspects the error chain to determine the layer.
+func layerFromChain(err error) string {
+	// DNS errors are the most specific
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return LayerDNS
+	}
+
+	// TLS errors are next
+	var (
+		alertErr  tls.AlertError
+		headerErr tls.RecordHeaderError
+		verifyErr *tls.CertificateVerificationError
+	)
+	if errors.As(err, &alertErr) || errors.As(err, &headerErr) || errors.As(err, &verifyErr) {
+		return LayerTLS
+	}
+
+	// Transport-layer errors are reported using [*net.OpError]
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		switch {
+		case strings.HasPrefix(opErr.Net, "tcp"):
+			return LayerTCP
+		case strings.HasPrefix(opErr.Net, "udp"):
+			return LayerUDP
+		}
+	}
+
+	// The HTTP client wraps all errors using [*url.Error]
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return LayerHTTP
+	}
+	return ""
+}
+
+// Attrs returns the [*Info] as a list of [slog.Attr] suitable for
+// emitting them as extra fields along with `err` and `errClass`.
+//
+// The `errErrno` field is only included when Errno is not zero.
+func (i *Info) Attrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("errClass", i.Class),
+		slog.String("errLayer", i.Layer),
+		slog.Bool("errTimeout", i.Timeout),
+		slog.Bool("errTemporary", i.Temporary),
+		slog.Bool("errRetryable", i.Retryable),
+	}
+	if i.Errno != 0 {
+		attrs = append(attrs, slog.Int("errErrno", int(i.Errno)))
+	}
+	return attrs
+}
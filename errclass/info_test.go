@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package errclass
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  error
+		expect *Info
+	}{
+		{
+			name:   "nil error",
+			input:  nil,
+			expect: &Info{},
+		},
+
+		{
+			name: "connection reset during TCP read",
+			input: &net.OpError{
+				Op:  "read",
+				Net: "tcp",
+				Err: os.NewSyscallError("read", errECONNRESET),
+			},
+			expect: &Info{
+				Class:     ECONNRESET,
+				Layer:     LayerTCP,
+				Timeout:   false,
+				Temporary: true,
+				Retryable: true,
+				Errno:     errECONNRESET,
+			},
+		},
+
+		{
+			name: "connection refused during UDP write",
+			input: &net.OpError{
+				Op:  "write",
+				Net: "udp",
+				Err: os.NewSyscallError("write", errECONNREFUSED),
+			},
+			expect: &Info{
+				Class:     ECONNREFUSED,
+				Layer:     LayerUDP,
+				Timeout:   false,
+				Temporary: false,
+				Retryable: true,
+				Errno:     errECONNREFUSED,
+			},
+		},
+
+		{
+			name: "DNS no such host",
+			input: &net.DNSError{
+				Err:        "no such host",
+				Name:       "www.example.com",
+				IsNotFound: true,
+			},
+			expect: &Info{
+				Class:     EDNS_NONAME,
+				Layer:     LayerDNS,
+				Timeout:   false,
+				Temporary: false,
+				Retryable: false,
+			},
+		},
+
+		{
+			name: "DNS server misbehaving",
+			input: &net.DNSError{
+				Err:         "server misbehaving",
+				Name:        "www.example.com",
+				IsTemporary: true,
+			},
+			expect: &Info{
+				Class:     EDNS_SERVFAIL,
+				Layer:     LayerDNS,
+				Timeout:   false,
+				Temporary: true,
+				Retryable: true,
+			},
+		},
+
+		{
+			name: "DNS timeout",
+			input: &net.DNSError{
+				Err:       "i/o timeout",
+				Name:      "www.example.com",
+				IsTimeout: true,
+			},
+			expect: &Info{
+				Class:     EGENERIC,
+				Layer:     LayerDNS,
+				Timeout:   true,
+				Temporary: true,
+				Retryable: true,
+			},
+		},
+
+		{
+			name: "TLS alert",
+			input: &net.OpError{
+				Op:  "remote error",
+				Err: tls.AlertError(40),
+			},
+			expect: &Info{
+				Class:     EGENERIC,
+				Layer:     LayerTLS,
+				Timeout:   false,
+				Temporary: false,
+				Retryable: false,
+			},
+		},
+
+		{
+			name: "HTTP client timeout",
+			input: &url.Error{
+				Op:  "Get",
+				URL: "https://www.example.com/",
+				Err: context.DeadlineExceeded,
+			},
+			expect: &Info{
+				Class:     ETIMEDOUT,
+				Layer:     LayerHTTP,
+				Timeout:   true,
+				Temporary: true,
+				Retryable: true,
+			},
+		},
+
+		{
+			name:  "context canceled",
+			input: context.Canceled,
+			expect: &Info{
+				Class:     EINTR,
+				Layer:     "",
+				Timeout:   false,
+				Temporary: false,
+				Retryable: false,
+			},
+		},
+
+		{
+			name:  "unknown error",
+			input: errors.New("unknown error"),
+			expect: &Info{
+				Class:     EGENERIC,
+				Layer:     "",
+				Timeout:   false,
+				Temporary: false,
+				Retryable: false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, NewInfo(tt.input))
+		})
+	}
+}
+
+func TestClassPropsMapIsComplete(t *testing.T) {
+	for _, class := range errorsIsMap {
+		t.Run(class, func(t *testing.T) {
+			_, found := classPropsMap[class]
+			assert.True(t, found, fmt.Sprintf("missing properties for %s", class))
+		})
+	}
+	for _, class := range stringSuffixMap {
+		t.Run(class, func(t *testing.T) {
+			_, found := classPropsMap[class]
+			assert.True(t, found, fmt.Sprintf("missing properties for %s", class))
+		})
+	}
+	for _, entry := range errorsAsList {
+		t.Run(entry.class, func(t *testing.T) {
+			_, found := classPropsMap[entry.class]
+			assert.True(t, found, fmt.Sprintf("missing properties for %s", entry.class))
+		})
+	}
+	for _, entry := range quicErrorsAsList {
+		t.Run(entry.class, func(t *testing.T) {
+			_, found := classPropsMap[entry.class]
+			assert.True(t, found, fmt.Sprintf("missing properties for %s", entry.class))
+		})
+	}
+}
+
+func TestInfoAttrs(t *testing.T) {
+	t.Run("without errno", func(t *testing.T) {
+		info := NewInfo(context.DeadlineExceeded)
+		expect := []slog.Attr{
+			slog.String("errClass", ETIMEDOUT),
+			slog.String("errLayer", ""),
+			slog.Bool("errTimeout", true),
+			slog.Bool("errTemporary", true),
+			slog.Bool("errRetryable", true),
+		}
+		got := info.Attrs()
+		assert.Equal(t, len(expect), len(got))
+		for idx := 0; idx < len(expect) && idx < len(got); idx++ {
+			assert.True(t, expect[idx].Equal(got[idx]), "%v != %v", expect[idx], got[idx])
+		}
+	})
+
+	t.Run("with errno", func(t *testing.T) {
+		info := NewInfo(os.NewSyscallError("connect", errECONNREFUSED))
+		attrs := info.Attrs()
+		last := attrs[len(attrs)-1]
+		assert.Equal(t, "errErrno", last.Key)
+		assert.Equal(t, int64(errECONNREFUSED), last.Value.Int64())
+	})
+}
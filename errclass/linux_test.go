@@ -0,0 +1,168 @@
+//go:build linux
+
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package errclass
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestNewWithProvokedErrors provokes system errors on Linux
+// and ensures that we classify them correctly.
+func TestNewWithProvokedErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		provoke func(t *testing.T) error
+		expect  string
+	}{
+		{
+			name: "EPIPE when writing to a pipe whose read end is closed",
+			provoke: func(t *testing.T) error {
+				r, w, err := os.Pipe()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer w.Close()
+				r.Close()
+				_, err = w.Write([]byte("abc"))
+				return err
+			},
+			expect: EPIPE,
+		},
+
+		{
+			name: "ENOENT when dialing a nonexistent Unix socket",
+			provoke: func(t *testing.T) error {
+				path := filepath.Join(t.TempDir(), "nonexistent.sock")
+				conn, err := net.Dial("unix", path)
+				if err == nil {
+					conn.Close()
+				}
+				return err
+			},
+			expect: ENOENT,
+		},
+
+		{
+			name: "EMSGSIZE when writing an oversized UDP datagram",
+			provoke: func(t *testing.T) error {
+				conn, err := net.Dial("udp4", "127.0.0.1:9")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				_, err = conn.Write(make([]byte, 1<<17))
+				return err
+			},
+			expect: EMSGSIZE,
+		},
+
+		{
+			name: "EAFNOSUPPORT when creating a socket with an invalid family",
+			provoke: func(t *testing.T) error {
+				fd, err := unix.Socket(unix.AF_MAX, unix.SOCK_STREAM, 0)
+				if err == nil {
+					unix.Close(fd)
+				}
+				return os.NewSyscallError("socket", err)
+			},
+			expect: EAFNOSUPPORT,
+		},
+
+		{
+			name: "EPERM when opening a raw socket without privileges",
+			provoke: func(t *testing.T) error {
+				if os.Geteuid() == 0 {
+					t.Skip("cannot provoke EPERM when running as root")
+				}
+				conn, err := net.ListenPacket("ip4:icmp", "127.0.0.1")
+				if err == nil {
+					conn.Close()
+					t.Skip("opening raw sockets is allowed")
+				}
+				return err
+			},
+			expect: EPERM,
+		},
+
+		{
+			name: "EACCES when binding a privileged port without privileges",
+			provoke: func(t *testing.T) error {
+				if os.Geteuid() == 0 {
+					t.Skip("cannot provoke EACCES when running as root")
+				}
+				conn, err := net.Listen("tcp", "127.0.0.1:1")
+				if err == nil {
+					conn.Close()
+					t.Skip("binding privileged ports is allowed")
+				}
+				return err
+			},
+			expect: EACCES,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.provoke(t)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := New(err); got != tt.expect {
+				t.Errorf("New(%v) = %v; want %v", err, got, tt.expect)
+			}
+		})
+	}
+}
+
+// TestNewWithProvokedEMFILE provokes EMFILE on Linux and ensures that
+// we classify it correctly. Because lowering RLIMIT_NOFILE affects the
+// whole process, we provoke the error in a subprocess.
+func TestNewWithProvokedEMFILE(t *testing.T) {
+	if os.Getenv("ERRCLASS_PROVOKE_EMFILE") == "1" {
+		provokeEMFILE()
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestNewWithProvokedEMFILE$")
+	cmd.Env = append(os.Environ(), "ERRCLASS_PROVOKE_EMFILE=1")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatal(err, string(output))
+	}
+	if got := string(output); !strings.HasPrefix(got, EMFILE+"\n") {
+		t.Errorf("got %q; want %q", got, EMFILE)
+	}
+}
+
+// provokeEMFILE lowers RLIMIT_NOFILE, provokes EMFILE, and prints
+// the class of the error to the standard output.
+func provokeEMFILE() {
+	var saved unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &saved); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// lower the soft limit so the next open fails; the value must
+	// be smaller than the number of descriptors already open
+	limit := unix.Rlimit{Cur: 3, Max: saved.Max}
+	if err := unix.Setrlimit(unix.RLIMIT_NOFILE, &limit); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fp, err := os.Open(os.DevNull)
+	if err == nil {
+		fp.Close()
+	}
+	unix.Setrlimit(unix.RLIMIT_NOFILE, &saved)
+	fmt.Println(New(err))
+}
@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package errclass
+
+import "errors"
+
+const (
+	// OpConnect is the operation of connecting a socket.
+	OpConnect = "connect"
+
+	// OpTLSHandshake is the operation of performing a TLS handshake.
+	OpTLSHandshake = "tls_handshake"
+
+	// OpRead is the operation of reading from a connection.
+	OpRead = "read"
+
+	// OpWrite is the operation of writing to a connection.
+	OpWrite = "write"
+
+	// OpResolve is the operation of resolving a domain name.
+	OpResolve = "resolve"
+
+	// OpQUICHandshake is the operation of performing a QUIC handshake.
+	OpQUICHandshake = "quic_handshake"
+)
+
+// OONIUnknownFailure is the OONI failure string for unclassified errors.
+//
+// OONI Probe typically emits this string followed by a colon and the
+// original error message (e.g., `unknown_failure: some error`).
+const OONIUnknownFailure = "unknown_failure"
+
+// ooniEntry is an entry in the OONI conversion table.
+type ooniEntry struct {
+	// class is the errclass class.
+	class string
+
+	// operation is the operation that failed or an empty
+	// string if the entry applies to any operation.
+	operation string
+
+	// failure is the OONI failure string.
+	failure string
+
+	// toOONIOnly indicates that [FromOONIFailure] must skip this entry
+	// because OONI Probe uses the same failure for a more generic class.
+	toOONIOnly bool
+}
+
+// ooniTable is the conversion table between classes and OONI failure strings.
+//
+// Entries with a specific operation take precedence over the generic entries
+// when converting to OONI. When converting from OONI, the first entry matching
+// the failure string wins, therefore generic entries come first, and we skip
+// the entries mapping more specific classes to the same failure string.
+var ooniTable = []ooniEntry{
+	{class: EACCES, operation: "", failure: "permission_denied"},
+	{class: EADDRNOTAVAIL, operation: "", failure: "address_not_available"},
+	{class: EADDRINUSE, operation: "", failure: "address_in_use"},
+	{class: EAFNOSUPPORT, operation: "", failure: "address_family_not_supported"},
+	{class: ECONNABORTED, operation: "", failure: "connection_aborted"},
+	{class: ECONNREFUSED, operation: "", failure: "connection_refused"},
+	{class: ECONNRESET, operation: "", failure: "connection_reset"},
+	{class: EHOSTUNREACH, operation: "", failure: "host_unreachable"},
+	{class: EEOF, operation: "", failure: "eof_error"},
+	{class: EINVAL, operation: "", failure: "invalid_argument"},
+	{class: EINTR, operation: "", failure: "interrupted"},
+	{class: EMSGSIZE, operation: "", failure: "message_size"},
+	{class: ENETDOWN, operation: "", failure: "network_down"},
+	{class: ENETRESET, operation: "", failure: "network_reset"},
+	{class: ENETUNREACH, operation: "", failure: "network_unreachable"},
+	{class: ENOBUFS, operation: "", failure: "no_buffer_space"},
+	{class: ENOTCONN, operation: "", failure: "not_connected"},
+	{class: EPROTONOSUPPORT, operation: "", failure: "protocol_not_supported"},
+	{class: ETIMEDOUT, operation: "", failure: "generic_timeout_error"},
+	{class: EDNS_NONAME, operation: "", failure: "dns_nxdomain_error"},
+	{class: EDNS_NODATA, operation: "", failure: "dns_no_answer"},
+	{class: EDNS_SERVFAIL, operation: "", failure: "dns_servfail_error"},
+	{class: EDNS_REFUSED, operation: "", failure: "dns_refused_error"},
+	{class: ETLS_HOSTNAME_MISMATCH, operation: "", failure: "ssl_invalid_hostname"},
+	{class: ETLS_CA_UNKNOWN, operation: "", failure: "ssl_unknown_authority"},
+	{class: ETLS_CERT_INVALID, operation: "", failure: "ssl_invalid_certificate"},
+	{class: EQUIC_VERSION_NEGOTIATION, operation: "", failure: "quic_incompatible_version"},
+	{class: EGENERIC, operation: "", failure: OONIUnknownFailure},
+
+	// entries only used when converting to OONI
+	{class: EQUIC_HANDSHAKE_TIMEOUT, operation: "", failure: "generic_timeout_error", toOONIOnly: true},
+	{class: EQUIC_IDLE_TIMEOUT, operation: "", failure: "generic_timeout_error", toOONIOnly: true},
+	{class: EQUIC_STATELESS_RESET, operation: "", failure: "connection_reset", toOONIOnly: true},
+
+	// operation-specific entries
+	{class: EGENERIC, operation: OpTLSHandshake, failure: "ssl_failed_handshake"},
+}
+
+// ooniUnmappedClasses contains the classes for which OONI Probe does not
+// emit a specific failure string, which map to [OONIUnknownFailure].
+//
+// OONI Probe emits specific failure strings for some QUIC CRYPTO_ERROR and
+// transport errors, which [NewOONIFailure] handles by inspecting the error.
+var ooniUnmappedClasses = map[string]bool{
+	EMFILE:                  true,
+	ENFILE:                  true,
+	ENOENT:                  true,
+	EPERM:                   true,
+	EPIPE:                   true,
+	EQUIC_CRYPTO_ERROR:      true,
+	EQUIC_TRANSPORT_ERROR:   true,
+	EQUIC_APPLICATION_ERROR: true,
+}
+
+// ooniQUICAlertFailures maps the TLS alerts embedded in a QUIC CRYPTO_ERROR
+// to the failure strings emitted by OONI Probe for them.
+var ooniQUICAlertFailures = map[uint8]string{
+	40:  "ssl_failed_handshake",    // handshake_failure
+	42:  "ssl_invalid_certificate", // bad_certificate
+	43:  "ssl_invalid_certificate", // unsupported_certificate
+	44:  "ssl_invalid_certificate", // certificate_revoked
+	45:  "ssl_invalid_certificate", // certificate_expired
+	46:  "ssl_invalid_certificate", // certificate_unknown
+	51:  "ssl_failed_handshake",    // decrypt_error
+	112: "ssl_invalid_hostname",    // unrecognized_name
+}
+
+// quicConnectionRefused is the CONNECTION_REFUSED QUIC transport error code.
+const quicConnectionRefused = 0x02
+
+// ToOONIFailure converts the given class and the operation that
+// failed (e.g., [OpConnect]) to an OONI failure string.
+//
+// The empty class maps to an empty string. Unknown classes and classes
+// for which OONI Probe has no failure string map to [OONIUnknownFailure].
+func ToOONIFailure(class, operation string) string {
+	// exclude the empty class case first
+	if class == "" {
+		return ""
+	}
+
+	// prefer entries specific to the given operation
+	for _, entry := range ooniTable {
+		if entry.class == class && entry.operation != "" && entry.operation == operation {
+			return entry.failure
+		}
+	}
+
+	// fallback to entries applying to any operation
+	for _, entry := range ooniTable {
+		if entry.class == class && entry.operation == "" {
+			return entry.failure
+		}
+	}
+	return OONIUnknownFailure
+}
+
+// FromOONIFailure converts the given OONI failure string to a class.
+//
+// The empty failure maps to an empty string. Unknown failures, including
+// `unknown_failure: ...` strings, map to [EGENERIC].
+func FromOONIFailure(failure string) string {
+	// exclude the empty failure case first
+	if failure == "" {
+		return ""
+	}
+
+	// search for an exact match in the conversion table
+	for _, entry := range ooniTable {
+		if !entry.toOONIOnly && entry.failure == failure {
+			return entry.class
+		}
+	}
+
+	// we don't know this failure or it is an `unknown_failure: ...`
+	return EGENERIC
+}
+
+// NewOONIFailure classifies the given error using [New] and converts
+// the class to an OONI failure string using [ToOONIFailure].
+//
+// For QUIC CRYPTO_ERROR and transport errors, this function follows OONI
+// Probe and uses the TLS alert (see [QUICTLSAlert]) or the transport error
+// code to choose the failure string. For unclassified errors, this function
+// follows OONI Probe and returns [OONIUnknownFailure] followed by the error
+// message.
+func NewOONIFailure(err error, operation string) string {
+	if failure := newOONIQUICFailure(err); failure != "" {
+		return failure
+	}
+	failure := ToOONIFailure(New(err), operation)
+	if failure == OONIUnknownFailure {
+		failure = OONIUnknownFailure + ": " + err.Error()
+	}
+	return failure
+}
+
+// newOONIQUICFailure returns the OONI failure string for a QUIC CRYPTO_ERROR
+// or transport error, or an empty string if there is no specific string.
+func newOONIQUICFailure(err error) string {
+	if alert, found := QUICTLSAlert(err); found {
+		return ooniQUICAlertFailures[alert]
+	}
+	var transportErr QUICTransportError
+	if errors.As(err, &transportErr) && transportErr.QUICTransportErrorCode() == quicConnectionRefused {
+		return "connection_refused"
+	}
+	return ""
+}
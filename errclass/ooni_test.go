@@ -0,0 +1,365 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package errclass
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// allOperations contains all the operations we know about.
+var allOperations = []string{
+	"",
+	OpConnect,
+	OpTLSHandshake,
+	OpRead,
+	OpWrite,
+	OpResolve,
+	OpQUICHandshake,
+}
+
+func TestOONITableIsComplete(t *testing.T) {
+	for class := range classPropsMap {
+		t.Run(class, func(t *testing.T) {
+			var found bool
+			for _, entry := range ooniTable {
+				found = found || (entry.class == class && entry.operation == "")
+			}
+			assert.True(t, found != ooniUnmappedClasses[class], "missing or unexpected OONI failure for "+class)
+		})
+	}
+}
+
+// ooniToOONIOnlyClasses returns the classes with a generic entry only used
+// when converting to OONI.
+func ooniToOONIOnlyClasses() map[string]bool {
+	classes := map[string]bool{}
+	for _, entry := range ooniTable {
+		if entry.toOONIOnly && entry.operation == "" {
+			classes[entry.class] = true
+		}
+	}
+	return classes
+}
+
+func TestOONIRoundTrip(t *testing.T) {
+	t.Run("class to failure to class", func(t *testing.T) {
+		for class := range classPropsMap {
+			for _, op := range allOperations {
+				t.Run(class+"/"+op, func(t *testing.T) {
+					failure := ToOONIFailure(class, op)
+					if ooniUnmappedClasses[class] {
+						assert.Equal(t, OONIUnknownFailure, failure)
+						return
+					}
+					assert.NotEmpty(t, failure)
+					if ooniToOONIOnlyClasses()[class] {
+						// the failure maps back to a more generic class
+						assert.Equal(t, failure, ToOONIFailure(FromOONIFailure(failure), op))
+						return
+					}
+					assert.Equal(t, class, FromOONIFailure(failure))
+				})
+			}
+		}
+	})
+
+	t.Run("failure to class to failure", func(t *testing.T) {
+		for _, entry := range ooniTable {
+			if entry.toOONIOnly {
+				continue
+			}
+			t.Run(entry.failure, func(t *testing.T) {
+				class := FromOONIFailure(entry.failure)
+				assert.Equal(t, entry.class, class)
+				assert.Equal(t, entry.failure, ToOONIFailure(class, entry.operation))
+			})
+		}
+	})
+}
+
+func TestToOONIFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		class     string
+		operation string
+		expect    string
+	}{
+		{
+			name:      "empty class",
+			class:     "",
+			operation: OpConnect,
+			expect:    "",
+		},
+
+		{
+			name:      "connection reset during read",
+			class:     ECONNRESET,
+			operation: OpRead,
+			expect:    "connection_reset",
+		},
+
+		{
+			name:      "timeout during connect",
+			class:     ETIMEDOUT,
+			operation: OpConnect,
+			expect:    "generic_timeout_error",
+		},
+
+		{
+			name:      "SERVFAIL during resolve",
+			class:     EDNS_SERVFAIL,
+			operation: OpResolve,
+			expect:    "dns_servfail_error",
+		},
+
+		{
+			name:      "generic error during TLS handshake",
+			class:     EGENERIC,
+			operation: OpTLSHandshake,
+			expect:    "ssl_failed_handshake",
+		},
+
+		{
+			name:      "generic error during read",
+			class:     EGENERIC,
+			operation: OpRead,
+			expect:    OONIUnknownFailure,
+		},
+
+		{
+			name:      "class without an OONI failure string",
+			class:     EMFILE,
+			operation: OpConnect,
+			expect:    OONIUnknownFailure,
+		},
+
+		{
+			name:      "QUIC version negotiation failure",
+			class:     EQUIC_VERSION_NEGOTIATION,
+			operation: OpQUICHandshake,
+			expect:    "quic_incompatible_version",
+		},
+
+		{
+			name:      "QUIC handshake timeout",
+			class:     EQUIC_HANDSHAKE_TIMEOUT,
+			operation: OpQUICHandshake,
+			expect:    "generic_timeout_error",
+		},
+
+		{
+			name:      "QUIC idle timeout",
+			class:     EQUIC_IDLE_TIMEOUT,
+			operation: OpRead,
+			expect:    "generic_timeout_error",
+		},
+
+		{
+			name:      "QUIC stateless reset",
+			class:     EQUIC_STATELESS_RESET,
+			operation: OpRead,
+			expect:    "connection_reset",
+		},
+
+		{
+			name:      "QUIC crypto error without the TLS alert",
+			class:     EQUIC_CRYPTO_ERROR,
+			operation: OpQUICHandshake,
+			expect:    OONIUnknownFailure,
+		},
+
+		{
+			name:      "unknown class",
+			class:     "ENOTEXIST",
+			operation: OpRead,
+			expect:    OONIUnknownFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, ToOONIFailure(tt.class, tt.operation))
+		})
+	}
+}
+
+func TestFromOONIFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure string
+		expect  string
+	}{
+		{
+			name:    "empty failure",
+			failure: "",
+			expect:  "",
+		},
+
+		{
+			name:    "NXDOMAIN",
+			failure: "dns_nxdomain_error",
+			expect:  EDNS_NONAME,
+		},
+
+		{
+			name:    "generic timeout",
+			failure: "generic_timeout_error",
+			expect:  ETIMEDOUT,
+		},
+
+		{
+			name:    "connection reset",
+			failure: "connection_reset",
+			expect:  ECONNRESET,
+		},
+
+		{
+			name:    "unknown failure with message",
+			failure: "unknown_failure: some error",
+			expect:  EGENERIC,
+		},
+
+		{
+			name:    "unknown failure string",
+			failure: "not_an_ooni_failure",
+			expect:  EGENERIC,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, FromOONIFailure(tt.failure))
+		})
+	}
+}
+
+func TestNewOONIFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		operation string
+		expect    string
+	}{
+		{
+			name:      "nil error",
+			err:       nil,
+			operation: OpConnect,
+			expect:    "",
+		},
+
+		{
+			name:      "connection refused",
+			err:       os.NewSyscallError("connect", errECONNREFUSED),
+			operation: OpConnect,
+			expect:    "connection_refused",
+		},
+
+		{
+			name:      "generic error during TLS handshake",
+			err:       errors.New("tls: handshake failure"),
+			operation: OpTLSHandshake,
+			expect:    "ssl_failed_handshake",
+		},
+
+		{
+			name:      "broken pipe during write",
+			err:       os.NewSyscallError("write", errEPIPE),
+			operation: OpWrite,
+			expect:    "unknown_failure: write: " + errEPIPE.Error(),
+		},
+
+		{
+			name:      "generic error during read",
+			err:       errors.New("some error"),
+			operation: OpRead,
+			expect:    "unknown_failure: some error",
+		},
+
+		{
+			name:      "QUIC handshake timeout",
+			err:       &fakeQUICHandshakeTimeoutError{},
+			operation: OpQUICHandshake,
+			expect:    "generic_timeout_error",
+		},
+
+		{
+			name:      "QUIC idle timeout",
+			err:       &fakeQUICIdleTimeoutError{},
+			operation: OpRead,
+			expect:    "generic_timeout_error",
+		},
+
+		{
+			name:      "QUIC stateless reset",
+			err:       &fakeQUICStatelessResetError{},
+			operation: OpRead,
+			expect:    "connection_reset",
+		},
+
+		{
+			name:      "QUIC bad_certificate alert",
+			err:       &fakeQUICTransportError{code: 0x0100 + 42},
+			operation: OpQUICHandshake,
+			expect:    "ssl_invalid_certificate",
+		},
+
+		{
+			name:      "QUIC certificate_expired alert",
+			err:       &fakeQUICTransportError{code: 0x0100 + 45},
+			operation: OpQUICHandshake,
+			expect:    "ssl_invalid_certificate",
+		},
+
+		{
+			name:      "QUIC unrecognized_name alert",
+			err:       &fakeQUICTransportError{code: 0x0100 + 112},
+			operation: OpQUICHandshake,
+			expect:    "ssl_invalid_hostname",
+		},
+
+		{
+			name:      "QUIC handshake_failure alert",
+			err:       &fakeQUICTransportError{code: 0x0100 + 40},
+			operation: OpQUICHandshake,
+			expect:    "ssl_failed_handshake",
+		},
+
+		{
+			name:      "QUIC decrypt_error alert",
+			err:       &fakeQUICTransportError{code: 0x0100 + 51},
+			operation: OpQUICHandshake,
+			expect:    "ssl_failed_handshake",
+		},
+
+		{
+			name:      "QUIC alert without an OONI failure string",
+			err:       &fakeQUICTransportError{code: 0x0100 + 80},
+			operation: OpQUICHandshake,
+			expect:    "unknown_failure: transport error 0x150",
+		},
+
+		{
+			name:      "QUIC connection refused",
+			err:       &fakeQUICTransportError{code: 0x02},
+			operation: OpQUICHandshake,
+			expect:    "connection_refused",
+		},
+
+		{
+			name:      "QUIC transport error without an OONI failure string",
+			err:       &fakeQUICTransportError{code: 0x0a},
+			operation: OpQUICHandshake,
+			expect:    "unknown_failure: transport error 0xa",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, NewOONIFailure(tt.err, tt.operation))
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package errclass
+
+import "errors"
+
+// QUICHandshakeTimeoutError is the interface implemented by
+// errors indicating that the QUIC handshake timed out.
+type QUICHandshakeTimeoutError interface {
+	error
+	QUICHandshakeTimeout()
+}
+
+// QUICIdleTimeoutError is the interface implemented by errors indicating
+// that a QUIC connection was closed because of the idle timeout.
+type QUICIdleTimeoutError interface {
+	error
+	QUICIdleTimeout()
+}
+
+// QUICStatelessResetError is the interface implemented by errors
+// indicating that the peer sent a QUIC stateless reset.
+type QUICStatelessResetError interface {
+	error
+	QUICStatelessReset()
+}
+
+// QUICVersionNegotiationError is the interface implemented by errors
+// indicating that QUIC version negotiation failed.
+type QUICVersionNegotiationError interface {
+	error
+	QUICVersionNegotiation()
+}
+
+// QUICTransportError is the interface implemented by errors carrying a
+// QUIC transport error code (see RFC 9000, Section 20.1).
+type QUICTransportError interface {
+	error
+	QUICTransportErrorCode() uint64
+}
+
+// QUICApplicationError is the interface implemented by errors carrying
+// a QUIC application protocol error code (see RFC 9000, Section 20.2).
+type QUICApplicationError interface {
+	error
+	QUICApplicationErrorCode() uint64
+}
+
+const (
+	// quicCryptoErrorMin is the first CRYPTO_ERROR transport error code.
+	quicCryptoErrorMin = 0x0100
+
+	// quicCryptoErrorMax is the last CRYPTO_ERROR transport error code.
+	quicCryptoErrorMax = 0x01ff
+)
+
+// QUICTLSAlert returns the TLS alert embedded in a QUIC CRYPTO_ERROR
+// (see RFC 9001, Section 4.8) and whether the error is a CRYPTO_ERROR.
+func QUICTLSAlert(err error) (uint8, bool) {
+	var candidate QUICTransportError
+	if !errors.As(err, &candidate) {
+		return 0, false
+	}
+	code := candidate.QUICTransportErrorCode()
+	if code < quicCryptoErrorMin || code > quicCryptoErrorMax {
+		return 0, false
+	}
+	return uint8(code - quicCryptoErrorMin), true
+}
+
+// quicErrorsAsList contains the QUIC errors that we can map with [errors.As].
+//
+// We check these errors before [errorsIsMap] because QUIC libraries
+// commonly make timeout errors also match [net.ErrClosed].
+var quicErrorsAsList = []struct {
+	as    func(err error) bool
+	class string
+}{
+	{
+		as: func(err error) bool {
+			var candidate QUICHandshakeTimeoutError
+			return errors.As(err, &candidate)
+		},
+		class: EQUIC_HANDSHAKE_TIMEOUT,
+	},
+
+	{
+		as: func(err error) bool {
+			var candidate QUICIdleTimeoutError
+			return errors.As(err, &candidate)
+		},
+		class: EQUIC_IDLE_TIMEOUT,
+	},
+
+	{
+		as: func(err error) bool {
+			var candidate QUICStatelessResetError
+			return errors.As(err, &candidate)
+		},
+		class: EQUIC_STATELESS_RESET,
+	},
+
+	{
+		as: func(err error) bool {
+			var candidate QUICVersionNegotiationError
+			return errors.As(err, &candidate)
+		},
+		class: EQUIC_VERSION_NEGOTIATION,
+	},
+
+	{
+		as: func(err error) bool {
+			_, found := QUICTLSAlert(err)
+			return found
+		},
+		class: EQUIC_CRYPTO_ERROR,
+	},
+
+	{
+		as: func(err error) bool {
+			var candidate QUICTransportError
+			return errors.As(err, &candidate)
+		},
+		class: EQUIC_TRANSPORT_ERROR,
+	},
+
+	{
+		as: func(err error) bool {
+			var candidate QUICApplicationError
+			return errors.As(err, &candidate)
+		},
+		class: EQUIC_APPLICATION_ERROR,
+	},
+}
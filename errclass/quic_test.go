@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package errclass
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQUICTimeoutError mimics QUIC library timeout errors, which
+// typically also implement [net.Error] and match [net.ErrClosed].
+type fakeQUICTimeoutError struct{}
+
+func (e *fakeQUICTimeoutError) Error() string   { return "timeout: no recent network activity" }
+func (e *fakeQUICTimeoutError) Timeout() bool   { return true }
+func (e *fakeQUICTimeoutError) Temporary() bool { return false }
+func (e *fakeQUICTimeoutError) Is(target error) bool {
+	return target == net.ErrClosed
+}
+
+// fakeQUICHandshakeTimeoutError is a fake [QUICHandshakeTimeoutError].
+type fakeQUICHandshakeTimeoutError struct{ fakeQUICTimeoutError }
+
+func (e *fakeQUICHandshakeTimeoutError) QUICHandshakeTimeout() {}
+
+// fakeQUICIdleTimeoutError is a fake [QUICIdleTimeoutError].
+type fakeQUICIdleTimeoutError struct{ fakeQUICTimeoutError }
+
+func (e *fakeQUICIdleTimeoutError) QUICIdleTimeout() {}
+
+// fakeQUICStatelessResetError is a fake [QUICStatelessResetError].
+type fakeQUICStatelessResetError struct{}
+
+func (e *fakeQUICStatelessResetError) Error() string       { return "received a stateless reset" }
+func (e *fakeQUICStatelessResetError) QUICStatelessReset() {}
+
+// fakeQUICVersionNegotiationError is a fake [QUICVersionNegotiationError].
+type fakeQUICVersionNegotiationError struct{}
+
+func (e *fakeQUICVersionNegotiationError) Error() string           { return "no compatible QUIC version found" }
+func (e *fakeQUICVersionNegotiationError) QUICVersionNegotiation() {}
+
+// fakeQUICTransportError is a fake [QUICTransportError].
+type fakeQUICTransportError struct {
+	code uint64
+}
+
+func (e *fakeQUICTransportError) Error() string                  { return fmt.Sprintf("transport error %#x", e.code) }
+func (e *fakeQUICTransportError) QUICTransportErrorCode() uint64 { return e.code }
+
+// fakeQUICApplicationError is a fake [QUICApplicationError].
+type fakeQUICApplicationError struct {
+	code uint64
+}
+
+func (e *fakeQUICApplicationError) Error() string {
+	return fmt.Sprintf("application error %#x", e.code)
+}
+func (e *fakeQUICApplicationError) QUICApplicationErrorCode() uint64 { return e.code }
+
+func TestNewWithQUICErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  error
+		expect string
+	}{
+		{
+			name:   "handshake timeout",
+			input:  &fakeQUICHandshakeTimeoutError{},
+			expect: EQUIC_HANDSHAKE_TIMEOUT,
+		},
+
+		{
+			name:   "idle timeout",
+			input:  &fakeQUICIdleTimeoutError{},
+			expect: EQUIC_IDLE_TIMEOUT,
+		},
+
+		{
+			name:   "stateless reset",
+			input:  &fakeQUICStatelessResetError{},
+			expect: EQUIC_STATELESS_RESET,
+		},
+
+		{
+			name:   "version negotiation",
+			input:  &fakeQUICVersionNegotiationError{},
+			expect: EQUIC_VERSION_NEGOTIATION,
+		},
+
+		{
+			name:   "crypto error with TLS alert",
+			input:  &fakeQUICTransportError{code: 0x0100 + 42},
+			expect: EQUIC_CRYPTO_ERROR,
+		},
+
+		{
+			name:   "transport error",
+			input:  &fakeQUICTransportError{code: 0x0a},
+			expect: EQUIC_TRANSPORT_ERROR,
+		},
+
+		{
+			name:   "application error",
+			input:  &fakeQUICApplicationError{code: 0x0101},
+			expect: EQUIC_APPLICATION_ERROR,
+		},
+
+		{
+			name:   "wrapped idle timeout",
+			input:  fmt.Errorf("read: %w", &fakeQUICIdleTimeoutError{}),
+			expect: EQUIC_IDLE_TIMEOUT,
+		},
+
+		{
+			name:   "stateless reset wrapped in a UDP OpError",
+			input:  &net.OpError{Op: "read", Net: "udp", Err: &fakeQUICStatelessResetError{}},
+			expect: EQUIC_STATELESS_RESET,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, New(tt.input))
+			info := NewInfo(tt.input)
+			assert.Equal(t, tt.expect, info.Class)
+			assert.Equal(t, LayerQUIC, info.Layer)
+		})
+	}
+}
+
+func TestQUICTLSAlert(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       error
+		expectAlert uint8
+		expectFound bool
+	}{
+		{
+			name:        "nil error",
+			input:       nil,
+			expectAlert: 0,
+			expectFound: false,
+		},
+
+		{
+			name:        "not a transport error",
+			input:       &fakeQUICApplicationError{code: 0x0128},
+			expectAlert: 0,
+			expectFound: false,
+		},
+
+		{
+			name:        "transport error below the crypto range",
+			input:       &fakeQUICTransportError{code: 0x00ff},
+			expectAlert: 0,
+			expectFound: false,
+		},
+
+		{
+			name:        "bad_certificate alert",
+			input:       &fakeQUICTransportError{code: 0x0100 + 42},
+			expectAlert: 42,
+			expectFound: true,
+		},
+
+		{
+			name:        "last crypto error",
+			input:       &fakeQUICTransportError{code: 0x01ff},
+			expectAlert: 0xff,
+			expectFound: true,
+		},
+
+		{
+			name:        "transport error above the crypto range",
+			input:       &fakeQUICTransportError{code: 0x0200},
+			expectAlert: 0,
+			expectFound: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert, found := QUICTLSAlert(tt.input)
+			assert.Equal(t, tt.expectAlert, alert)
+			assert.Equal(t, tt.expectFound, found)
+		})
+	}
+}
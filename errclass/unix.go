@@ -7,18 +7,34 @@ package errclass
 import "golang.org/x/sys/unix"
 
 const (
+	errEACCES          = unix.EACCES
 	errEADDRNOTAVAIL   = unix.EADDRNOTAVAIL
 	errEADDRINUSE      = unix.EADDRINUSE
+	errEAFNOSUPPORT    = unix.EAFNOSUPPORT
 	errECONNABORTED    = unix.ECONNABORTED
 	errECONNREFUSED    = unix.ECONNREFUSED
 	errECONNRESET      = unix.ECONNRESET
 	errEHOSTUNREACH    = unix.EHOSTUNREACH
 	errEINVAL          = unix.EINVAL
 	errEINTR           = unix.EINTR
+	errEMFILE          = unix.EMFILE
+	errEMSGSIZE        = unix.EMSGSIZE
 	errENETDOWN        = unix.ENETDOWN
+	errENETRESET       = unix.ENETRESET
 	errENETUNREACH     = unix.ENETUNREACH
+	errENFILE          = unix.ENFILE
 	errENOBUFS         = unix.ENOBUFS
+	errENOENT          = unix.ENOENT
 	errENOTCONN        = unix.ENOTCONN
+	errEPERM           = unix.EPERM
+	errEPIPE           = unix.EPIPE
 	errEPROTONOSUPPORT = unix.EPROTONOSUPPORT
 	errETIMEDOUT       = unix.ETIMEDOUT
 )
+
+// errorsIsPlatformMap contains the errors that we can map with [errors.Is]
+// and that have no direct equivalent on all the platforms.
+var errorsIsPlatformMap = map[error]string{
+	errENFILE: ENFILE,
+	errEPERM:  EPERM,
+}
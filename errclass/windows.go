@@ -7,18 +7,39 @@ package errclass
 import "golang.org/x/sys/windows"
 
 const (
+	errEACCES          = windows.WSAEACCES
 	errEADDRNOTAVAIL   = windows.WSAEADDRNOTAVAIL
 	errEADDRINUSE      = windows.WSAEADDRINUSE
+	errEAFNOSUPPORT    = windows.WSAEAFNOSUPPORT
 	errECONNABORTED    = windows.WSAECONNABORTED
 	errECONNREFUSED    = windows.WSAECONNREFUSED
 	errECONNRESET      = windows.WSAECONNRESET
 	errEHOSTUNREACH    = windows.WSAEHOSTUNREACH
 	errEINVAL          = windows.WSAEINVAL
 	errEINTR           = windows.WSAEINTR
+	errEMFILE          = windows.WSAEMFILE
+	errEMSGSIZE        = windows.WSAEMSGSIZE
 	errENETDOWN        = windows.WSAENETDOWN
+	errENETRESET       = windows.WSAENETRESET
 	errENETUNREACH     = windows.WSAENETUNREACH
 	errENOBUFS         = windows.WSAENOBUFS
 	errENOTCONN        = windows.WSAENOTCONN
 	errEPROTONOSUPPORT = windows.WSAEPROTONOSUPPORT
 	errETIMEDOUT       = windows.WSAETIMEDOUT
+
+	// Windows does not have WSA equivalents for these errors,
+	// so we use the closest matching system error codes.
+	errENOENT = windows.ERROR_FILE_NOT_FOUND
+	errEPIPE  = windows.ERROR_BROKEN_PIPE
 )
+
+// errorsIsPlatformMap contains the errors that we can map with [errors.Is]
+// and that have no direct equivalent on all the platforms.
+//
+// Windows has no equivalent of ENFILE and EPERM. ERROR_TOO_MANY_OPEN_FILES
+// is the per-process limit like WSAEMFILE and ERROR_ACCESS_DENIED is the
+// equivalent of EACCES, so we map them to EMFILE and EACCES.
+var errorsIsPlatformMap = map[error]string{
+	windows.ERROR_ACCESS_DENIED:       EACCES,
+	windows.ERROR_TOO_MANY_OPEN_FILES: EMFILE,
+}
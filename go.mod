@@ -5,6 +5,7 @@ go 1.23.0
 require (
 	github.com/google/go-cmp v0.6.0
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/net v0.40.0
 	golang.org/x/sys v0.33.0
 )
 
@@ -0,0 +1,317 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package happyeyeballs implements a Happy Eyeballs (RFC 8305) dialer that
+// reports every connection attempt, so we know which addresses were tried,
+// which one won, and why the others failed.
+//
+// Use [NewDialer] to construct a [*Dialer] and use its DialContext method,
+// which is a [dialonce.DialContextFunc].
+package happyeyeballs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/rbmk-project/common/dialonce"
+	"github.com/rbmk-project/common/errclass"
+	"github.com/rbmk-project/common/netipx"
+)
+
+// DefaultAttemptDelay is the default delay between starting two
+// connection attempts, as recommended by RFC 8305 Section 5.
+const DefaultAttemptDelay = 250 * time.Millisecond
+
+// Attempt describes a completed connection attempt.
+type Attempt struct {
+	// Index is the zero-based index of the attempt.
+	Index int
+
+	// Network is the network we used (e.g., "tcp").
+	Network string
+
+	// RemoteAddr is the address we tried.
+	RemoteAddr netip.AddrPort
+
+	// LocalAddr is the local address, or the unspecified IPv6
+	// address and port zero if the attempt failed.
+	LocalAddr netip.AddrPort
+
+	// Err is the error that occurred, if any.
+	Err error
+
+	// ErrClass is the [errclass] of Err.
+	ErrClass string
+
+	// Won indicates whether this attempt won the race. Attempts that
+	// succeed after the winner are closed and have Won set to false.
+	Won bool
+
+	// T0 is when the attempt started.
+	T0 time.Time
+
+	// T is when the attempt completed.
+	T time.Time
+}
+
+// Dialer is a Happy Eyeballs dialer.
+//
+// We resolve the host name, sort the addresses interleaving the address
+// families starting with IPv6, and start a new connection attempt every
+// AttemptDelay or as soon as the previous attempt fails. The first
+// successful attempt wins, and we cancel all the other attempts.
+//
+// Construct using [NewDialer].
+type Dialer struct {
+	// AttemptDelay is the OPTIONAL delay between starting two connection
+	// attempts. If zero or negative, we use [DefaultAttemptDelay].
+	AttemptDelay time.Duration
+
+	// Dial is the OPTIONAL function to dial a single IP address.
+	// If nil, we use a zero-initialized [*net.Dialer].
+	Dial dialonce.DialContextFunc
+
+	// Logger is the OPTIONAL logger to use. If nil, we don't log. We emit the
+	// `connectAttemptStart` and `connectAttemptDone` events, where the latter
+	// includes the same information contained in an [*Attempt].
+	Logger *slog.Logger
+
+	// LookupNetIP is the OPTIONAL function to resolve a host name. If nil,
+	// we use the LookupNetIP method of [net.DefaultResolver].
+	LookupNetIP func(ctx context.Context, network, host string) ([]netip.Addr, error)
+
+	// OnAttempt is the OPTIONAL function called after each attempt completes.
+	// We call this function synchronously, before returning from DialContext.
+	OnAttempt func(attempt *Attempt)
+
+	// TimeNow is the OPTIONAL function to get the current time.
+	// If nil, we use [time.Now].
+	TimeNow func() time.Time
+}
+
+// NewDialer creates a new [*Dialer] using the given logger.
+func NewDialer(logger *slog.Logger) *Dialer {
+	return &Dialer{Logger: logger, TimeNow: time.Now}
+}
+
+// timeNow returns the current time using TimeNow or [time.Now].
+func (d *Dialer) timeNow() time.Time {
+	if d.TimeNow != nil {
+		return d.TimeNow()
+	}
+	return time.Now()
+}
+
+// attemptDelay returns AttemptDelay or [DefaultAttemptDelay].
+func (d *Dialer) attemptDelay() time.Duration {
+	if d.AttemptDelay > 0 {
+		return d.AttemptDelay
+	}
+	return DefaultAttemptDelay
+}
+
+// dial dials a single address using Dial or a [*net.Dialer].
+func (d *Dialer) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.Dial != nil {
+		return d.Dial(ctx, network, address)
+	}
+	return (&net.Dialer{}).DialContext(ctx, network, address)
+}
+
+// ErrNoAddresses indicates that the host name resolved to no usable addresses.
+var ErrNoAddresses = errors.New("happyeyeballs: no usable addresses")
+
+// lookup resolves the host name unless it is an IP address and returns
+// the addresses sorted according to RFC 8305 Section 4.
+func (d *Dialer) lookup(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return sortAddrs(network, []netip.Addr{addr})
+	}
+	ipNetwork := "ip"
+	switch network {
+	case "tcp4", "udp4":
+		ipNetwork = "ip4"
+	case "tcp6", "udp6":
+		ipNetwork = "ip6"
+	}
+	lookup := net.DefaultResolver.LookupNetIP
+	if d.LookupNetIP != nil {
+		lookup = d.LookupNetIP
+	}
+	addrs, err := lookup(ctx, ipNetwork, host)
+	if err != nil {
+		return nil, err
+	}
+	return sortAddrs(network, addrs)
+}
+
+// sortAddrs filters the addresses by network and interleaves the address
+// families, starting with IPv6, while preserving the order within each family.
+func sortAddrs(network string, addrs []netip.Addr) ([]netip.Addr, error) {
+	var v4, v6 []netip.Addr
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		switch {
+		case addr.Is4() && network != "tcp6" && network != "udp6":
+			v4 = append(v4, addr)
+		case addr.Is6() && network != "tcp4" && network != "udp4":
+			v6 = append(v6, addr)
+		}
+	}
+	sorted := make([]netip.Addr, 0, len(v4)+len(v6))
+	for idx := 0; idx < max(len(v4), len(v6)); idx++ {
+		if idx < len(v6) {
+			sorted = append(sorted, v6[idx])
+		}
+		if idx < len(v4) {
+			sorted = append(sorted, v4[idx])
+		}
+	}
+	if len(sorted) <= 0 {
+		return nil, ErrNoAddresses
+	}
+	return sorted, nil
+}
+
+// attemptResult is the result of a connection attempt.
+type attemptResult struct {
+	attempt *Attempt
+	conn    net.Conn
+}
+
+// DialContext dials a network connection with the given network and address.
+//
+// When all the attempts fail, we return the error of the first attempt.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	// Resolve the host name and parse the port.
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := d.lookup(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure we cancel the pending attempts when done.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		firstErr error
+		next     int
+		pending  int
+		results  = make(chan *attemptResult, len(addrs))
+		timer    = time.NewTimer(d.attemptDelay())
+		winner   net.Conn
+	)
+	defer timer.Stop()
+
+	// startNext starts the next attempt, if any, and resets the timer.
+	startNext := func() {
+		if next >= len(addrs) {
+			return
+		}
+		attempt := &Attempt{
+			Index:      next,
+			Network:    network,
+			RemoteAddr: netip.AddrPortFrom(addrs[next], uint16(port)),
+			T0:         d.timeNow(),
+		}
+		d.logAttemptStart(ctx, attempt)
+		go d.try(ctx, attempt, results)
+		next, pending = next+1, pending+1
+		timer.Reset(d.attemptDelay())
+	}
+
+	// Run the race until all the attempts we started complete.
+	startNext()
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if winner == nil {
+				startNext()
+			}
+
+		case result := <-results:
+			pending--
+			attempt := result.attempt
+			switch {
+			case attempt.Err != nil:
+				if firstErr == nil {
+					firstErr = attempt.Err
+				}
+				if winner == nil {
+					startNext()
+				}
+			case winner == nil:
+				attempt.Won, winner = true, result.conn
+				cancel()
+			default:
+				result.conn.Close()
+			}
+			d.logAttemptDone(ctx, attempt)
+			if d.OnAttempt != nil {
+				d.OnAttempt(attempt)
+			}
+		}
+	}
+
+	if winner == nil {
+		return nil, firstErr
+	}
+	return winner, nil
+}
+
+// try performs a single connection attempt.
+func (d *Dialer) try(ctx context.Context, attempt *Attempt, results chan<- *attemptResult) {
+	conn, err := d.dial(ctx, attempt.Network, attempt.RemoteAddr.String())
+	attempt.T = d.timeNow()
+	attempt.Err = err
+	attempt.ErrClass = errclass.New(err)
+	attempt.LocalAddr = netipx.AddrToAddrPort(nil)
+	if err == nil {
+		attempt.LocalAddr = netipx.AddrToAddrPort(conn.LocalAddr())
+	}
+	results <- &attemptResult{attempt: attempt, conn: conn}
+}
+
+func (d *Dialer) logAttemptStart(ctx context.Context, attempt *Attempt) {
+	if d.Logger != nil {
+		d.Logger.InfoContext(
+			ctx,
+			"connectAttemptStart",
+			slog.Int("connectAttempt", attempt.Index),
+			slog.String("protocol", attempt.Network),
+			slog.String("remoteAddr", attempt.RemoteAddr.String()),
+			slog.Time("t", attempt.T0),
+		)
+	}
+}
+
+func (d *Dialer) logAttemptDone(ctx context.Context, attempt *Attempt) {
+	if d.Logger != nil {
+		d.Logger.InfoContext(
+			ctx,
+			"connectAttemptDone",
+			slog.Any("err", attempt.Err),
+			slog.String("errClass", attempt.ErrClass),
+			slog.Int("connectAttempt", attempt.Index),
+			slog.Bool("connectAttemptWon", attempt.Won),
+			slog.String("localAddr", attempt.LocalAddr.String()),
+			slog.String("protocol", attempt.Network),
+			slog.String("remoteAddr", attempt.RemoteAddr.String()),
+			slog.Time("t0", attempt.T0),
+			slog.Time("t", attempt.T),
+			slog.Duration("duration", attempt.T.Sub(attempt.T0)),
+		)
+	}
+}
@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package happyeyeballs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rbmk-project/common/dialonce"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// make sure we can compose with the dialonce package
+var _ dialonce.DialContextFunc = NewDialer(nil).DialContext
+
+// newListener creates a listener accepting and closing connections or skips
+// the test if we cannot listen on the given address (e.g., no IPv6 support).
+func newListener(t *testing.T, address string) net.Listener {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("cannot listen on %s: %s", address, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return listener
+}
+
+// lookupLoopback resolves any host name to ::1 and 127.0.0.1.
+func lookupLoopback(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	return []netip.Addr{netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("::1")}, nil
+}
+
+// newTestDialer creates a new [*Dialer] collecting the attempts.
+func newTestDialer(out *bytes.Buffer) (*Dialer, *[]*Attempt) {
+	var (
+		attempts []*Attempt
+		mu       sync.Mutex
+	)
+	dialer := NewDialer(slog.New(slog.NewJSONHandler(out, nil)))
+	dialer.LookupNetIP = lookupLoopback
+	dialer.AttemptDelay = 50 * time.Millisecond
+	dialer.OnAttempt = func(attempt *Attempt) {
+		mu.Lock()
+		attempts = append(attempts, attempt)
+		mu.Unlock()
+	}
+	return dialer, &attempts
+}
+
+func TestDialer(t *testing.T) {
+	t.Run("IPv6 wins when both families work", func(t *testing.T) {
+		listener := newListener(t, "[::]:0")
+		port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+		var out bytes.Buffer
+		dialer, attempts := newTestDialer(&out)
+		conn, err := dialer.DialContext(context.Background(), "tcp", net.JoinHostPort("example.com", port))
+		require.NoError(t, err)
+		defer conn.Close()
+
+		assert.Equal(t, "::1", conn.RemoteAddr().(*net.TCPAddr).AddrPort().Addr().String())
+		require.Len(t, *attempts, 1)
+		attempt := (*attempts)[0]
+		assert.True(t, attempt.Won)
+		assert.Equal(t, "[::1]:"+port, attempt.RemoteAddr.String())
+		assert.Equal(t, conn.LocalAddr().String(), attempt.LocalAddr.String())
+		assert.Equal(t, "", attempt.ErrClass)
+		assert.False(t, attempt.T.Before(attempt.T0))
+
+		// check the logged events
+		var names []string
+		decoder := json.NewDecoder(&out)
+		for decoder.More() {
+			var event map[string]any
+			require.NoError(t, decoder.Decode(&event))
+			names = append(names, event["msg"].(string))
+			if event["msg"] == "connectAttemptDone" {
+				assert.Equal(t, true, event["connectAttemptWon"])
+				assert.Equal(t, "[::1]:"+port, event["remoteAddr"])
+			}
+		}
+		assert.Equal(t, []string{"connectAttemptStart", "connectAttemptDone"}, names)
+	})
+
+	t.Run("IPv4 wins when IPv6 is refused", func(t *testing.T) {
+		newListener(t, "[::1]:0") // make sure IPv6 is available
+		listener := newListener(t, "127.0.0.1:0")
+		port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+		var out bytes.Buffer
+		dialer, attempts := newTestDialer(&out)
+		dialer.AttemptDelay = time.Hour // we must not wait for the delay on failure
+		conn, err := dialer.DialContext(context.Background(), "tcp", net.JoinHostPort("example.com", port))
+		require.NoError(t, err)
+		defer conn.Close()
+
+		require.Len(t, *attempts, 2)
+		first, second := (*attempts)[0], (*attempts)[1]
+		assert.Equal(t, "[::1]:"+port, first.RemoteAddr.String())
+		assert.Equal(t, "ECONNREFUSED", first.ErrClass)
+		assert.False(t, first.Won)
+		assert.Equal(t, "127.0.0.1:"+port, second.RemoteAddr.String())
+		assert.True(t, second.Won)
+		assert.Equal(t, 1, second.Index)
+	})
+
+	t.Run("IPv4 wins when IPv6 is slow", func(t *testing.T) {
+		listener := newListener(t, "127.0.0.1:0")
+		port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+		var out bytes.Buffer
+		dialer, attempts := newTestDialer(&out)
+		dialer.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			if address == "[::1]:"+port {
+				<-ctx.Done() // simulate a blackholed address
+				return nil, ctx.Err()
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		}
+		conn, err := dialer.DialContext(context.Background(), "tcp", net.JoinHostPort("example.com", port))
+		require.NoError(t, err)
+		defer conn.Close()
+
+		require.Len(t, *attempts, 2)
+		winner, loser := (*attempts)[0], (*attempts)[1]
+		assert.Equal(t, "127.0.0.1:"+port, winner.RemoteAddr.String())
+		assert.True(t, winner.Won)
+		assert.Equal(t, "[::1]:"+port, loser.RemoteAddr.String())
+		assert.Equal(t, "EINTR", loser.ErrClass)
+		assert.GreaterOrEqual(t, winner.T0.Sub(loser.T0), dialer.AttemptDelay)
+	})
+
+	t.Run("all attempts fail", func(t *testing.T) {
+		var out bytes.Buffer
+		dialer, attempts := newTestDialer(&out)
+		expected := errors.New("mocked error")
+		dialer.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, expected
+		}
+		conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:443")
+		assert.ErrorIs(t, err, expected)
+		assert.Nil(t, conn)
+		assert.Len(t, *attempts, 2)
+	})
+
+	t.Run("invalid addresses and lookup failures", func(t *testing.T) {
+		dialer := &Dialer{}
+		_, err := dialer.DialContext(context.Background(), "tcp", "example.com")
+		assert.Error(t, err)
+		_, err = dialer.DialContext(context.Background(), "tcp", "example.com:http")
+		assert.Error(t, err)
+		_, err = dialer.DialContext(context.Background(), "tcp6", "127.0.0.1:80")
+		assert.ErrorIs(t, err, ErrNoAddresses)
+
+		expected := errors.New("mocked error")
+		dialer.LookupNetIP = func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+			return nil, expected
+		}
+		_, err = dialer.DialContext(context.Background(), "tcp", "example.com:80")
+		assert.ErrorIs(t, err, expected)
+	})
+}
+
+func TestSortAddrs(t *testing.T) {
+	addrs := []netip.Addr{
+		netip.MustParseAddr("192.0.2.1"),
+		netip.MustParseAddr("192.0.2.2"),
+		netip.MustParseAddr("192.0.2.3"),
+		netip.MustParseAddr("2001:db8::1"),
+		netip.MustParseAddr("::ffff:192.0.2.4"),
+	}
+
+	tests := []struct {
+		network string
+		expect  []string
+	}{
+		{"tcp", []string{"2001:db8::1", "192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"}},
+		{"tcp4", []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"}},
+		{"tcp6", []string{"2001:db8::1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			sorted, err := sortAddrs(tt.network, addrs)
+			require.NoError(t, err)
+			var got []string
+			for _, addr := range sorted {
+				got = append(got, addr.String())
+			}
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
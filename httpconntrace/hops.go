@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpconntrace
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+)
+
+// Hop describes a single request within a redirect chain traced by [DoWithHops].
+type Hop struct {
+	// Method is the request method.
+	Method string
+
+	// URL is the request URL.
+	URL string
+
+	// StatusCode is the response status code or zero on failure.
+	StatusCode int
+
+	// Location is the value of the Location response header, if any.
+	Location string
+
+	// Endpoints contains the [*Endpoints] used by the request. The addresses
+	// are zero initialized (i.e., invalid) if we did not obtain a connection.
+	Endpoints *Endpoints
+}
+
+// DoWithHops is like [Do] but returns a [*Hop] for each request performed
+// while following redirects, in the order in which requests were performed.
+// The last [*Hop] corresponds to the returned response or error.
+//
+// Unlike [Do], this function composes its [net/http/httptrace] trace with the
+// trace possibly present in the request context. Internally, we use a copy of
+// the given [*http.Client] whose transport observes each request.
+func DoWithHops(client *http.Client, req *http.Request) (*http.Response, []*Hop, error) {
+	hr := &hopsRecorder{txp: client.Transport}
+	clientCopy := *client
+	clientCopy.Transport = hr
+	resp, err := clientCopy.Do(req)
+	return resp, hr.hops(), err
+}
+
+// hopsRecorder is an [http.RoundTripper] recording each [*Hop].
+type hopsRecorder struct {
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// recorded contains the recorded hops.
+	recorded []*Hop
+
+	// txp is the OPTIONAL underlying transport.
+	txp http.RoundTripper
+}
+
+// hops returns a copy of the recorded hops.
+func (hr *hopsRecorder) hops() []*Hop {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	out := make([]*Hop, 0, len(hr.recorded))
+	for _, hop := range hr.recorded {
+		hopCopy := *hop
+		epntsCopy := *hop.Endpoints
+		hopCopy.Endpoints = &epntsCopy
+		out = append(out, &hopCopy)
+	}
+	return out
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (hr *hopsRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	txp := hr.txp
+	if txp == nil {
+		txp = http.DefaultTransport
+	}
+
+	// Register the hop before performing the round trip.
+	hop := &Hop{Method: req.Method, URL: req.URL.String(), Endpoints: &Endpoints{}}
+	hr.mu.Lock()
+	hr.recorded = append(hr.recorded, hop)
+	hr.mu.Unlock()
+
+	// Compose our trace with the existing context trace, if any.
+	collector := newCollector()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), collector.trace()))
+
+	// Perform the round trip and record the results.
+	resp, err := txp.RoundTrip(req)
+	collector.done()
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	hop.Endpoints = collector.endpoints()
+	if err == nil {
+		hop.StatusCode = resp.StatusCode
+		hop.Location = resp.Header.Get("Location")
+	}
+	return resp, err
+}
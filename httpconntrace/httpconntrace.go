@@ -10,26 +10,89 @@ Operationally, you need to use [Do] where you would otherwise call
 [*http.Client.Do] method. The [*Endpoints] are returned along with the response.
 
 Collecting the connection [*Endpoints] is important to map the HTTP response
-with the connection that actually serviced the request.
+with the connection that actually serviced the request. The [*Endpoints] also
+include the [Timings] of each phase, which are the basis of latency measurements.
+
+When the request may be redirected, use [DoWithHops] to obtain a [*Hop] for
+each request in the redirect chain, including its [*Endpoints].
+
+When you cannot replace the [*http.Client.Do] calls (e.g., because a library
+performs them), use a [*RoundTripper] as the client transport and obtain the
+[*Endpoints] using [EndpointsFromResponse] or [ContextWithEndpointsFunc].
 */
 package httpconntrace
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
 	"net/http/httptrace"
 	"net/netip"
 	"sync"
+	"time"
+
+	"github.com/rbmk-project/common/netipx"
 )
 
-// Endpoints contains the connection endpoints extacted by [Do].
+// Endpoints contains the connection endpoints extacted by [Do] and [DoWithHops].
 type Endpoints struct {
+	// DNSAddrs contains the addresses returned by the DNS lookup performed
+	// to create the connection, which the transport tries in order. This
+	// field is nil when the connection was reused or we did not resolve.
+	DNSAddrs []netip.Addr
+
+	// IdleTime is how long the connection was idle, if WasIdle is true.
+	IdleTime time.Duration
+
 	// LocalAddr is the local address of the connection.
 	LocalAddr netip.AddrPort
 
+	// Protocol is the network of the connection (e.g., "tcp", "udp", "unix").
+	Protocol string
+
 	// RemoteAddr is the remote address of the connection.
 	RemoteAddr netip.AddrPort
+
+	// Reused indicates whether the connection was reused.
+	Reused bool
+
+	// Timings contains the duration of each phase of the operation.
+	Timings Timings
+
+	// TLS is the TLS connection state or nil if the connection is not a [*tls.Conn]
+	// or another connection type providing a ConnectionState method.
+	TLS *tls.ConnectionState
+
+	// WasIdle indicates whether the connection was obtained from the idle pool.
+	WasIdle bool
+}
+
+// NewEndpoints returns the [*Endpoints] used by the given connection.
+//
+// We use [netipx.AddrToAddrPort] to convert the connection addresses, therefore
+// TCP and UDP addresses are converted faithfully, while other address types
+// (e.g., unix domain sockets) become the unspecified IPv6 address and port zero.
+// Use the Protocol field to distinguish between these cases.
+func NewEndpoints(conn net.Conn) *Endpoints {
+	epnts := &Endpoints{
+		LocalAddr:  netipx.AddrToAddrPort(conn.LocalAddr()),
+		Protocol:   netipx.AddrNetwork(conn.LocalAddr(), ""),
+		RemoteAddr: netipx.AddrToAddrPort(conn.RemoteAddr()),
+	}
+	if tc, ok := conn.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		state := tc.ConnectionState()
+		epnts.TLS = &state
+	}
+	return epnts
+}
+
+// ID returns a string identifying the connection, which is suitable to
+// correlate events emitted while using the same connection. Because the
+// operating system does not reuse a local and remote endpoints pair for
+// concurrent connections, the pair is enough to identify a connection.
+func (epnts *Endpoints) ID() string {
+	return epnts.LocalAddr.String() + "->" + epnts.RemoteAddr.String()
 }
 
 // Do performs an HTTP request using [*http.Client.Do] and uses [net/http/httptrace] to
@@ -40,37 +103,24 @@ type Endpoints struct {
 // that may have already been present in the request context. Obviously, this means that
 // using this function prevents one to observe connection events with a trace.
 //
-// Note that this function assumes we're using TCP and casts the connection addresses
-// to [*net.TCPAddr] to extract the endpoints. If the we're not using TCP, the returned
-// [*Endpoint] will contain zero initialized (i.e., invalid) addresses.
+// When following redirects, the returned [*Endpoints] refer to the last connection
+// we used. Use [DoWithHops] to obtain the [*Endpoints] used by each request.
+//
+// The returned [*Endpoints] contain zero initialized (i.e., invalid) addresses if we
+// could not obtain a connection. See [NewEndpoints] for non-TCP connections.
 //
 // We return *Endpoints rather than Endpoints because the structure is larger than 32 bytes
 // and could possibly be further extended in the future to include additional fields.
 func Do(client *http.Client, req *http.Request) (*http.Response, *Endpoints, error) {
 	// Prepare to collect info in a goroutine-safe way.
-	var (
-		laddr netip.AddrPort
-		mu    sync.Mutex
-		raddr netip.AddrPort
-	)
+	collector := newCollector()
 
 	// Create clean context for tracing where "clean" means
 	// we don't compose with other possible context traces
 	traceCtx, cancel := context.WithCancel(context.Background())
 
-	// Configure the trace for extracting laddr, raddr
-	trace := &httptrace.ClientTrace{
-		GotConn: func(info httptrace.GotConnInfo) {
-			mu.Lock()
-			defer mu.Unlock()
-			if addr, ok := info.Conn.LocalAddr().(*net.TCPAddr); ok {
-				laddr = addr.AddrPort()
-			}
-			if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
-				raddr = addr.AddrPort()
-			}
-		},
-	}
+	// Configure the trace for extracting the endpoints
+	trace := collector.trace()
 	req = req.WithContext(httptrace.WithClientTrace(traceCtx, trace))
 
 	// Arrange for the inner context to be canceled
@@ -89,12 +139,169 @@ func Do(client *http.Client, req *http.Request) (*http.Response, *Endpoints, err
 	// Perform the request
 	resp, err := client.Do(req)
 
-	// Gather the local and remote endpoints while holding the mutex
-	// to avoid data-racing with the tracing goroutine.
-	mu.Lock()
-	epnts := &Endpoints{LocalAddr: laddr, RemoteAddr: raddr}
-	mu.Unlock()
+	// Gather the endpoints in a goroutine-safe way.
+	collector.done()
+	epnts := collector.endpoints()
 
 	// Return the results to the caller.
 	return resp, epnts, err
 }
+
+// collector collects [*Endpoints] using [net/http/httptrace].
+//
+// Construct using [newCollector].
+type collector struct {
+	// connectT0 is when we started connecting or the zero time.
+	connectT0 time.Time
+
+	// dnsAddrs contains the addresses resolved by the last DNS lookup.
+	dnsAddrs []netip.Addr
+
+	// dnsT0 is when we started the DNS lookup.
+	dnsT0 time.Time
+
+	// epnts contains the last [*Endpoints] or nil.
+	epnts *Endpoints
+
+	// firstByte is when we received the first response byte.
+	firstByte time.Time
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// pending contains the connection-related [Timings] that we have
+	// not yet assigned to [*Endpoints] because GotConn did not fire.
+	pending Timings
+
+	// t is when the operation completed or the zero time.
+	t time.Time
+
+	// t0 is when the operation started.
+	t0 time.Time
+
+	// tlsT0 is when we started the TLS handshake.
+	tlsT0 time.Time
+}
+
+// newCollector creates a new [*collector] marking the operation start.
+func newCollector() *collector {
+	return &collector{t0: time.Now()}
+}
+
+// trace returns the [*httptrace.ClientTrace] to use.
+func (c *collector) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             c.dnsStart,
+		DNSDone:              c.dnsDone,
+		ConnectStart:         c.connectStart,
+		ConnectDone:          c.connectDone,
+		TLSHandshakeStart:    c.tlsHandshakeStart,
+		TLSHandshakeDone:     c.tlsHandshakeDone,
+		GotConn:              c.gotConn,
+		GotFirstResponseByte: c.gotFirstResponseByte,
+	}
+}
+
+func (c *collector) dnsStart(httptrace.DNSStartInfo) {
+	t := time.Now()
+	c.mu.Lock()
+	c.dnsT0 = t
+	c.mu.Unlock()
+}
+
+func (c *collector) dnsDone(info httptrace.DNSDoneInfo) {
+	t := time.Now()
+	addrs := make([]netip.Addr, 0, len(info.Addrs))
+	for _, ipAddr := range info.Addrs {
+		if addr, ok := netip.AddrFromSlice(ipAddr.IP); ok {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	c.mu.Lock()
+	c.dnsAddrs = addrs
+	c.pending.DNS = t.Sub(c.dnsT0)
+	c.mu.Unlock()
+}
+
+func (c *collector) connectStart(network, addr string) {
+	t := time.Now()
+	c.mu.Lock()
+	if c.connectT0.IsZero() {
+		c.connectT0 = t
+	}
+	c.mu.Unlock()
+}
+
+func (c *collector) connectDone(network, addr string, err error) {
+	t := time.Now()
+	c.mu.Lock()
+	// ignore a losing parallel dial completing after GotConn, which
+	// has already assigned the timings and cleared the start time
+	if !c.connectT0.IsZero() {
+		c.pending.Connect = t.Sub(c.connectT0)
+	}
+	c.mu.Unlock()
+}
+
+func (c *collector) tlsHandshakeStart() {
+	t := time.Now()
+	c.mu.Lock()
+	c.tlsT0 = t
+	c.mu.Unlock()
+}
+
+func (c *collector) tlsHandshakeDone(tls.ConnectionState, error) {
+	t := time.Now()
+	c.mu.Lock()
+	c.pending.TLSHandshake = t.Sub(c.tlsT0)
+	c.mu.Unlock()
+}
+
+func (c *collector) gotConn(info httptrace.GotConnInfo) {
+	epnts := NewEndpoints(info.Conn)
+	epnts.IdleTime = info.IdleTime
+	epnts.Reused = info.Reused
+	epnts.WasIdle = info.WasIdle
+	c.mu.Lock()
+	epnts.DNSAddrs, c.dnsAddrs = c.dnsAddrs, nil
+	epnts.Timings, c.pending, c.connectT0 = c.pending, Timings{}, time.Time{}
+	c.epnts = epnts
+	c.mu.Unlock()
+}
+
+func (c *collector) gotFirstResponseByte() {
+	t := time.Now()
+	c.mu.Lock()
+	c.firstByte = t
+	c.mu.Unlock()
+}
+
+// done marks the operation as complete.
+func (c *collector) done() {
+	t := time.Now()
+	c.mu.Lock()
+	c.t = t
+	c.mu.Unlock()
+}
+
+// endpoints returns a copy of the last [*Endpoints] we collected or
+// zero initialized [*Endpoints] if we did not obtain any connection.
+//
+// When we did not obtain any connection, the [Timings] contain the
+// durations of the connection-related operations we attempted.
+func (c *collector) endpoints() *Endpoints {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	epnts := &Endpoints{Timings: c.pending}
+	if c.epnts != nil {
+		*epnts = *c.epnts
+	}
+	epnts.Timings.Start = c.t0
+	if !c.firstByte.IsZero() {
+		epnts.Timings.TimeToFirstByte = c.firstByte.Sub(c.t0)
+	}
+	if !c.t.IsZero() {
+		epnts.Timings.Total = c.t.Sub(c.t0)
+	}
+	return epnts
+}
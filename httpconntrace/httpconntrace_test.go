@@ -3,11 +3,25 @@
 package httpconntrace_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
 
 	"github.com/rbmk-project/common/httpconntrace"
+	"github.com/rbmk-project/common/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Example() {
@@ -40,3 +54,333 @@ func Example() {
 	// Local: true
 	// Remote: true
 }
+
+func ExampleEndpoints_ID() {
+	epnts := &httpconntrace.Endpoints{
+		LocalAddr:  netip.MustParseAddrPort("127.0.0.1:54321"),
+		RemoteAddr: netip.MustParseAddrPort("93.184.216.34:443"),
+	}
+	fmt.Println(epnts.ID())
+
+	// Output:
+	// 127.0.0.1:54321->93.184.216.34:443
+}
+
+func ExampleDoWithHops() {
+	// Create a test server that redirects twice
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/a", http.StatusMovedPermanently)
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		default:
+			w.Write([]byte("Hello, World!"))
+		}
+	}))
+	defer ts.Close()
+
+	// Create and send request
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		fmt.Printf("failed to create request: %s\n", err)
+		return
+	}
+
+	// Use DoWithHops instead of client.Do to get each hop
+	resp, hops, err := httpconntrace.DoWithHops(ts.Client(), req)
+	if err != nil {
+		fmt.Printf("request failed: %s\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Print the hops we collected
+	for _, hop := range hops {
+		fmt.Printf("%s %s %d %q %v %v\n", hop.Method, strings.TrimPrefix(hop.URL, ts.URL),
+			hop.StatusCode, hop.Location, hop.Endpoints.RemoteAddr.IsValid(), hop.Endpoints.Reused)
+	}
+
+	// Output:
+	// GET  301 "/a" true false
+	// GET /a 302 "/b" true true
+	// GET /b 200 "" true true
+}
+
+func TestNewEndpoints(t *testing.T) {
+	conn := &mocks.Conn{
+		MockLocalAddr:  func() net.Addr { return nil },
+		MockRemoteAddr: func() net.Addr { return nil },
+	}
+	epnts := httpconntrace.NewEndpoints(conn)
+	assert.Equal(t, "", epnts.Protocol)
+	assert.Equal(t, netip.AddrPortFrom(netip.IPv6Unspecified(), 0), epnts.LocalAddr)
+	assert.Nil(t, epnts.TLS)
+}
+
+func TestDo(t *testing.T) {
+	t.Run("with TLS and connection reuse", func(t *testing.T) {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("Hello, World!"))
+		}))
+		defer srv.Close()
+
+		// make sure we need to resolve the host name
+		URL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+		URL.Host = net.JoinHostPort("localhost", URL.Port())
+		client := srv.Client()
+		client.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+
+		var all []*httpconntrace.Endpoints
+		for idx := 0; idx < 2; idx++ {
+			req, err := http.NewRequest("GET", URL.String(), nil)
+			require.NoError(t, err)
+			resp, epnts, err := httpconntrace.Do(client, req)
+			require.NoError(t, err)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			all = append(all, epnts)
+		}
+
+		first, second := all[0], all[1]
+		assert.Equal(t, "tcp", first.Protocol)
+		assert.True(t, first.LocalAddr.IsValid())
+		assert.True(t, first.RemoteAddr.Addr().IsLoopback())
+		assert.NotEmpty(t, first.DNSAddrs)
+		assert.Contains(t, first.DNSAddrs, first.RemoteAddr.Addr())
+		assert.False(t, first.Reused)
+		require.NotNil(t, first.TLS)
+		assert.True(t, first.TLS.HandshakeComplete)
+
+		assert.True(t, second.Reused)
+		assert.True(t, second.WasIdle)
+		assert.Nil(t, second.DNSAddrs)
+		assert.Equal(t, first.ID(), second.ID())
+
+		// the phases of the first request must be consistent
+		timings := first.Timings
+		assert.False(t, timings.Start.IsZero())
+		assert.Greater(t, timings.DNS, time.Duration(0))
+		assert.Greater(t, timings.Connect, time.Duration(0))
+		assert.Greater(t, timings.TLSHandshake, time.Duration(0))
+		assert.Greater(t, timings.TimeToFirstByte, timings.DNS+timings.Connect+timings.TLSHandshake)
+		assert.GreaterOrEqual(t, timings.Total, timings.TimeToFirstByte)
+
+		// the reused connection must not account for connecting
+		timings = second.Timings
+		assert.True(t, timings.Start.After(first.Timings.Start))
+		assert.Equal(t, time.Duration(0), timings.DNS)
+		assert.Equal(t, time.Duration(0), timings.Connect)
+		assert.Equal(t, time.Duration(0), timings.TLSHandshake)
+		assert.Greater(t, timings.TimeToFirstByte, time.Duration(0))
+		assert.GreaterOrEqual(t, timings.Total, timings.TimeToFirstByte)
+	})
+
+	t.Run("with a unix domain socket", func(t *testing.T) {
+		listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+		require.NoError(t, err)
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("Hello, World!"))
+		}))
+		srv.Listener.Close()
+		srv.Listener = listener
+		srv.Start()
+		defer srv.Close()
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", listener.Addr().String())
+			},
+		}}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest("GET", "http://example.com/", nil)
+		require.NoError(t, err)
+		resp, epnts, err := httpconntrace.Do(client, req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, "unix", epnts.Protocol)
+		assert.Equal(t, netip.AddrPortFrom(netip.IPv6Unspecified(), 0), epnts.RemoteAddr)
+		assert.Nil(t, epnts.TLS)
+	})
+
+	t.Run("with a late ConnectDone from a losing dial", func(t *testing.T) {
+		traces := make(chan *httptrace.ClientTrace, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				// simulate a losing parallel dial completing after GotConn
+				trace := <-traces
+				trace.ConnectDone("tcp", "[::1]:80", errors.New("operation was canceled"))
+				http.Redirect(w, r, "/b", http.StatusFound)
+				return
+			}
+			w.Write([]byte("Hello, World!"))
+		}))
+		defer srv.Close()
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				traces <- httptrace.ContextClientTrace(ctx)
+				return (&net.Dialer{}).DialContext(ctx, network, address)
+			},
+		}}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest("GET", srv.URL, nil)
+		require.NoError(t, err)
+		resp, epnts, err := httpconntrace.Do(client, req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		// the redirect reuses the connection, so we must not account for connecting
+		assert.True(t, epnts.Reused)
+		assert.Equal(t, time.Duration(0), epnts.Timings.Connect)
+	})
+
+	t.Run("without a connection", func(t *testing.T) {
+		// obtain an address where nobody is listening
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		address := listener.Addr().String()
+		listener.Close()
+
+		req, err := http.NewRequest("GET", "http://"+address+"/", nil)
+		require.NoError(t, err)
+		_, epnts, err := httpconntrace.Do(http.DefaultClient, req)
+		require.Error(t, err)
+		assert.False(t, epnts.LocalAddr.IsValid())
+		assert.False(t, epnts.RemoteAddr.IsValid())
+		assert.Equal(t, time.Duration(0), epnts.Timings.TimeToFirstByte)
+		assert.Greater(t, epnts.Timings.Connect, time.Duration(0))
+		assert.GreaterOrEqual(t, epnts.Timings.Total, epnts.Timings.Connect)
+	})
+}
+
+func ExampleRoundTripper() {
+	// Create a test server that just echoes back
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, World!"))
+	}))
+	defer ts.Close()
+
+	// Create a client using the RoundTripper, which we could
+	// pass to any library calling the client.Do method
+	client := &http.Client{Transport: httpconntrace.NewRoundTripper(http.DefaultTransport)}
+
+	// Send request
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		fmt.Printf("request failed: %s\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Print the endpoints we collected
+	endpoints := httpconntrace.EndpointsFromResponse(resp)
+	fmt.Printf("Local: %v\n", endpoints.LocalAddr.IsValid())
+	fmt.Printf("Remote: %v\n", endpoints.RemoteAddr.IsValid())
+
+	// Output:
+	// Local: true
+	// Remote: true
+}
+
+func TestRoundTripper(t *testing.T) {
+	t.Run("with redirects", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				http.Redirect(w, r, "/final", http.StatusFound)
+				return
+			}
+			w.Write([]byte("Hello, World!"))
+		}))
+		defer srv.Close()
+
+		var (
+			all  []*httpconntrace.Endpoints
+			urls []string
+		)
+		ctx := httpconntrace.ContextWithEndpointsFunc(context.Background(),
+			func(req *http.Request, epnts *httpconntrace.Endpoints) {
+				urls = append(urls, req.URL.Path)
+				all = append(all, epnts)
+			})
+		req, err := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+		require.NoError(t, err)
+		client := &http.Client{Transport: &httpconntrace.RoundTripper{}}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, []string{"", "/final"}, urls)
+		require.Len(t, all, 2)
+		assert.False(t, all[0].Reused)
+		assert.True(t, all[1].Reused)
+		assert.Equal(t, all[1], httpconntrace.EndpointsFromResponse(resp))
+	})
+
+	t.Run("with a late ConnectDone from a losing dial", func(t *testing.T) {
+		traces := make(chan *httptrace.ClientTrace, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				// simulate a losing parallel dial completing after GotConn
+				trace := <-traces
+				trace.ConnectDone("tcp", "[::1]:80", errors.New("operation was canceled"))
+				http.Redirect(w, r, "/b", http.StatusFound)
+				return
+			}
+			w.Write([]byte("Hello, World!"))
+		}))
+		defer srv.Close()
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				traces <- httptrace.ContextClientTrace(ctx)
+				return (&net.Dialer{}).DialContext(ctx, network, address)
+			},
+		}}
+		defer client.CloseIdleConnections()
+		req, err := http.NewRequest("GET", srv.URL, nil)
+		require.NoError(t, err)
+		resp, epnts, err := httpconntrace.Do(client, req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		// the redirect reuses the connection, so we must not account for connecting
+		assert.True(t, epnts.Reused)
+		assert.Equal(t, time.Duration(0), epnts.Timings.Connect)
+	})
+
+	t.Run("without a connection", func(t *testing.T) {
+		// obtain an address where nobody is listening
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		address := listener.Addr().String()
+		listener.Close()
+
+		var got *httpconntrace.Endpoints
+		ctx := httpconntrace.ContextWithEndpointsFunc(context.Background(),
+			func(req *http.Request, epnts *httpconntrace.Endpoints) {
+				got = epnts
+			})
+		req, err := http.NewRequestWithContext(ctx, "GET", "http://"+address+"/", nil)
+		require.NoError(t, err)
+		client := &http.Client{Transport: httpconntrace.NewRoundTripper(nil)}
+		resp, err := client.Do(req)
+		require.Error(t, err)
+		assert.Nil(t, resp)
+		assert.False(t, got.LocalAddr.IsValid())
+		assert.False(t, got.RemoteAddr.IsValid())
+		assert.Equal(t, time.Duration(0), got.Timings.TimeToFirstByte)
+		assert.Greater(t, got.Timings.Connect, time.Duration(0))
+		assert.GreaterOrEqual(t, got.Timings.Total, got.Timings.Connect)
+	})
+
+	t.Run("with a response not obtained using the RoundTripper", func(t *testing.T) {
+		assert.Nil(t, httpconntrace.EndpointsFromResponse(nil))
+		assert.Nil(t, httpconntrace.EndpointsFromResponse(&http.Response{}))
+		req, err := http.NewRequest("GET", "http://example.com/", nil)
+		require.NoError(t, err)
+		assert.Nil(t, httpconntrace.EndpointsFromResponse(&http.Response{Request: req}))
+	})
+}
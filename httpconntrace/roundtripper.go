@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpconntrace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+)
+
+// RoundTripper is an [http.RoundTripper] collecting the [*Endpoints] used
+// by each round trip. Unlike [Do], it works with any code calling the
+// [*http.Client.Do] method internally, does not create any goroutine,
+// and composes its trace with any trace present in the request context.
+//
+// Use [EndpointsFromResponse] to obtain the [*Endpoints] used by a
+// response and [ContextWithEndpointsFunc] to be notified about the
+// [*Endpoints] used by each round trip, including failed ones and the
+// ones performed while following redirects.
+//
+// The zero value is ready to use.
+type RoundTripper struct {
+	// Transport is the OPTIONAL underlying [http.RoundTripper].
+	// If nil, we use [http.DefaultTransport].
+	Transport http.RoundTripper
+}
+
+var _ http.RoundTripper = &RoundTripper{}
+
+// NewRoundTripper creates a new [*RoundTripper] using the given transport.
+func NewRoundTripper(txp http.RoundTripper) *RoundTripper {
+	return &RoundTripper{Transport: txp}
+}
+
+// endpointsKey is the context key for the collected [*Endpoints].
+type endpointsKey struct{}
+
+// endpointsFuncKey is the context key for the func registered
+// using [ContextWithEndpointsFunc].
+type endpointsFuncKey struct{}
+
+// ContextWithEndpointsFunc returns a copy of the context such that the
+// [*RoundTripper] invokes the given function after each round trip using
+// the request and the [*Endpoints] used by the round trip. The function
+// is invoked synchronously, before returning the response to the caller.
+func ContextWithEndpointsFunc(ctx context.Context, fx func(req *http.Request, epnts *Endpoints)) context.Context {
+	return context.WithValue(ctx, endpointsFuncKey{}, fx)
+}
+
+// EndpointsFromResponse returns the [*Endpoints] used by the given
+// response, provided that the response was obtained using a [*RoundTripper],
+// or nil otherwise. When following redirects, the [*Endpoints] are the
+// ones used by the request that generated the final response.
+func EndpointsFromResponse(resp *http.Response) *Endpoints {
+	if resp == nil || resp.Request == nil {
+		return nil
+	}
+	collector, _ := resp.Request.Context().Value(endpointsKey{}).(*collector)
+	if collector == nil {
+		return nil
+	}
+	return collector.endpoints()
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	txp := rt.Transport
+	if txp == nil {
+		txp = http.DefaultTransport
+	}
+
+	// Compose our trace with the existing context trace, if any, and
+	// store the collector into the context, which is available after the
+	// round trip through the request referenced by the response.
+	collector := newCollector()
+	ctx := httptrace.WithClientTrace(req.Context(), collector.trace())
+	ctx = context.WithValue(ctx, endpointsKey{}, collector)
+	req = req.WithContext(ctx)
+
+	// Perform the round trip and possibly notify about the endpoints.
+	resp, err := txp.RoundTrip(req)
+	collector.done()
+	if fx, ok := req.Context().Value(endpointsFuncKey{}).(func(*http.Request, *Endpoints)); ok && fx != nil {
+		fx(req, collector.endpoints())
+	}
+	if resp != nil && resp.Request == nil {
+		resp.Request = req
+	}
+	return resp, err
+}
@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpconntrace
+
+import "time"
+
+// Timings contains the duration of each phase of an HTTP operation, i.e., a
+// call to [Do], a single request traced by [DoWithHops], or a round trip
+// performed by a [*RoundTripper]. When following redirects using [Do], the
+// connection-related durations refer to the last connection we used, while
+// TimeToFirstByte and Total are measured from the beginning of the operation.
+//
+// When we reuse a connection, the DNS, Connect, and TLSHandshake durations
+// are zero, since we did not need to perform the corresponding operations.
+type Timings struct {
+	// Start is when the operation started.
+	Start time.Time
+
+	// DNS is the time spent resolving the host name.
+	DNS time.Duration
+
+	// Connect is the time spent connecting, measured from the first connect
+	// attempt to the last connect attempt completing. With TLS, this field
+	// does not include the time spent performing the TLS handshake.
+	Connect time.Duration
+
+	// TLSHandshake is the time spent performing the TLS handshake.
+	TLSHandshake time.Duration
+
+	// TimeToFirstByte is the time elapsed from Start until we received the
+	// first response byte. This field is zero if we received no response.
+	TimeToFirstByte time.Duration
+
+	// Total is the time elapsed from Start until the operation completed, i.e.,
+	// until we received the response headers or the operation failed.
+	Total time.Duration
+}
@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rbmk-project/common/errclass"
+)
+
+const (
+	// BodyEncodingUTF8 indicates that the body snapshot is a UTF-8 string.
+	BodyEncodingUTF8 = "utf-8"
+
+	// BodyEncodingBase64 indicates that the body snapshot is base64 encoded.
+	BodyEncodingBase64 = "base64"
+)
+
+// ErrBodyClosedEarly is the error we log when the caller closes
+// the response body before reading it until EOF.
+var ErrBodyClosedEarly = errors.New("httpslog: body closed before EOF")
+
+// encodeBody encodes the body for safely including it into JSON
+// and returns the encoded body along with the encoding name.
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), BodyEncodingUTF8
+	}
+	return base64.StdEncoding.EncodeToString(body), BodyEncodingBase64
+}
+
+// trimIncompleteRune removes an incomplete trailing UTF-8 character, if any.
+func trimIncompleteRune(body []byte) []byte {
+	for idx := len(body) - 1; idx >= 0 && idx >= len(body)-utf8.UTFMax; idx-- {
+		if utf8.RuneStart(body[idx]) {
+			if !utf8.FullRune(body[idx:]) {
+				return body[:idx]
+			}
+			break
+		}
+	}
+	return body
+}
+
+// MaybeLogResponseBodySnapshot logs a snapshot of the response body if
+// the given logger is not nil, otherwise it does nothing.
+//
+// The snapshot is logged as a UTF-8 string when it is valid UTF-8 and is
+// otherwise base64 encoded. The `httpResponseBodyEncoding` field tells
+// which encoding we used. The truncated flag indicates whether the
+// snapshot is a strict prefix of the response body, in which case we
+// omit a trailing UTF-8 character cut by the truncation. The
+// `httpResponseBodyLength` field is the number of bytes we logged.
+func MaybeLogResponseBodySnapshot(
+	logger *slog.Logger,
+	localAddr netip.AddrPort,
+	protocol string,
+	remoteAddr netip.AddrPort,
+	req *http.Request,
+	snapshot []byte,
+	truncated bool,
+	t time.Time,
+) {
+	if logger != nil {
+		logger = withCorrelation(logger, req.Context())
+		redactor := redactorFromContext(req.Context())
+		if truncated {
+			snapshot = trimIncompleteRune(snapshot)
+		}
+		body, encoding := encodeBody(snapshot)
+		logger.InfoContext(
+			req.Context(),
+			"httpResponseBodySnapshot",
+			slog.String("httpMethod", req.Method),
+			slog.String("httpUrl", redactor.URL(req.URL)),
+			slog.String("httpResponseBody", body),
+			slog.String("httpResponseBodyEncoding", encoding),
+			slog.Bool("httpResponseBodyIsTruncated", truncated),
+			slog.Int("httpResponseBodyLength", len(snapshot)),
+			slog.String("localAddr", localAddr.String()),
+			slog.String("protocol", protocol),
+			slog.String("remoteAddr", remoteAddr.String()),
+			slog.Time("t", t),
+		)
+	}
+}
+
+// MaybeLogBodyReadDone logs that we finished reading the response body
+// if the given logger is not nil, otherwise it does nothing.
+//
+// The count argument is the total number of bytes read from the body. The
+// err argument is nil when we read the whole body, [ErrBodyClosedEarly] when
+// the caller closed the body before reading it fully, and otherwise is the
+// read error.
+func MaybeLogBodyReadDone(
+	logger *slog.Logger,
+	localAddr netip.AddrPort,
+	protocol string,
+	remoteAddr netip.AddrPort,
+	req *http.Request,
+	count int64,
+	err error,
+	t0 time.Time,
+	t time.Time,
+) {
+	if logger != nil {
+		logger = withCorrelation(logger, req.Context())
+		redactor := redactorFromContext(req.Context())
+		logger.InfoContext(
+			req.Context(),
+			"httpBodyReadDone",
+			slog.Any("err", redactor.Error(err)),
+			slog.Any("errClass", errclass.New(err)),
+			slog.String("httpMethod", req.Method),
+			slog.String("httpUrl", redactor.URL(req.URL)),
+			slog.Int64("httpResponseBodyBytesRead", count),
+			slog.String("localAddr", localAddr.String()),
+			slog.String("protocol", protocol),
+			slog.String("remoteAddr", remoteAddr.String()),
+			slog.Time("t0", t0),
+			slog.Time("t", t),
+			slog.Duration("duration", t.Sub(t0)),
+		)
+	}
+}
+
+// bodySnapshotter wraps a response body, passes all the bytes through
+// to the caller, keeps a bounded prefix of the body, and logs events
+// when we reach EOF, a read error occurs, or the body is closed.
+type bodySnapshotter struct {
+	// body is the wrapped response body.
+	body io.ReadCloser
+
+	// count is the number of bytes read so far.
+	count int64
+
+	// done indicates whether we have already logged.
+	done bool
+
+	// limit is the maximum snapshot size.
+	limit int64
+
+	// localAddr is the connection local address.
+	localAddr netip.AddrPort
+
+	// logger is the logger to use.
+	logger *slog.Logger
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// protocol is the connection protocol.
+	protocol string
+
+	// remoteAddr is the connection remote address.
+	remoteAddr netip.AddrPort
+
+	// req is the request that generated the response.
+	req *http.Request
+
+	// snapshot is the body prefix we collected.
+	snapshot []byte
+
+	// t0 is when we started reading the body.
+	t0 time.Time
+
+	// timeNow returns the current time.
+	timeNow func() time.Time
+
+	// truncated indicates whether the body is longer than the snapshot.
+	truncated bool
+}
+
+var _ io.ReadCloser = &bodySnapshotter{}
+
+// Read implements [io.Reader].
+func (b *bodySnapshotter) Read(data []byte) (int, error) {
+	count, err := b.body.Read(data)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.count += int64(count)
+	if room := b.limit - int64(len(b.snapshot)); room > 0 {
+		b.snapshot = append(b.snapshot, data[:min(int64(count), room)]...)
+	}
+	b.truncated = b.truncated || b.count > b.limit
+	if err != nil {
+		if err == io.EOF {
+			b.maybeLogLocked(nil)
+		} else {
+			b.maybeLogLocked(err)
+		}
+	}
+	return count, err
+}
+
+// Close implements [io.Closer].
+func (b *bodySnapshotter) Close() error {
+	err := b.body.Close()
+	b.mu.Lock()
+	b.maybeLogLocked(ErrBodyClosedEarly)
+	b.mu.Unlock()
+	return err
+}
+
+// maybeLogLocked logs the snapshot and the read done events
+// if we have not logged them yet. The caller must hold the mutex.
+func (b *bodySnapshotter) maybeLogLocked(err error) {
+	if b.done {
+		return
+	}
+	b.done = true
+	t := b.timeNow()
+	MaybeLogResponseBodySnapshot(
+		b.logger, b.localAddr, b.protocol, b.remoteAddr, b.req, b.snapshot, b.truncated, t)
+	MaybeLogBodyReadDone(
+		b.logger, b.localAddr, b.protocol, b.remoteAddr, b.req, b.count, err, b.t0, t)
+}
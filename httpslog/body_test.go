@@ -0,0 +1,322 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/rbmk-project/common/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaybeLogResponseBodySnapshot(t *testing.T) {
+	tests := []struct {
+		name      string
+		newLogger func(w io.Writer) *slog.Logger
+		snapshot  []byte
+		truncated bool
+		expectLog string
+	}{
+		{
+			name:      "Logger set with UTF-8 body",
+			newLogger: newTestLogger,
+			snapshot:  []byte("<html>blocked</html>"),
+			truncated: true,
+			expectLog: `{"level":"INFO","msg":"httpResponseBodySnapshot","httpMethod":"GET",` +
+				`"httpUrl":"https://example.com","httpResponseBody":"<html>blocked</html>",` +
+				`"httpResponseBodyEncoding":"utf-8","httpResponseBodyIsTruncated":true,` +
+				`"httpResponseBodyLength":20,"localAddr":"127.0.0.1:0","protocol":"tcp",` +
+				`"remoteAddr":"93.184.216.34:443","t":"2020-01-01T00:00:00Z"}` + "\n",
+		},
+
+		{
+			name:      "Logger set with binary body",
+			newLogger: newTestLogger,
+			snapshot:  []byte{0xff, 0x00, 0xfe},
+			truncated: false,
+			expectLog: `{"level":"INFO","msg":"httpResponseBodySnapshot","httpMethod":"GET",` +
+				`"httpUrl":"https://example.com","httpResponseBody":"/wD+",` +
+				`"httpResponseBodyEncoding":"base64","httpResponseBodyIsTruncated":false,` +
+				`"httpResponseBodyLength":3,"localAddr":"127.0.0.1:0","protocol":"tcp",` +
+				`"remoteAddr":"93.184.216.34:443","t":"2020-01-01T00:00:00Z"}` + "\n",
+		},
+
+		{
+			name:      "Logger set with UTF-8 body truncated in the middle of a character",
+			newLogger: newTestLogger,
+			snapshot:  []byte("<p>bloccato \xc3"), // the "\xc3\xa0" character is split
+			truncated: true,
+			expectLog: `{"level":"INFO","msg":"httpResponseBodySnapshot","httpMethod":"GET",` +
+				`"httpUrl":"https://example.com","httpResponseBody":"<p>bloccato ",` +
+				`"httpResponseBodyEncoding":"utf-8","httpResponseBodyIsTruncated":true,` +
+				`"httpResponseBodyLength":12,"localAddr":"127.0.0.1:0","protocol":"tcp",` +
+				`"remoteAddr":"93.184.216.34:443","t":"2020-01-01T00:00:00Z"}` + "\n",
+		},
+
+		{
+			name:      "Logger set with invalid UTF-8 body that is not truncated",
+			newLogger: newTestLogger,
+			snapshot:  []byte("<p>bloccato \xc3"),
+			truncated: false,
+			expectLog: `{"level":"INFO","msg":"httpResponseBodySnapshot","httpMethod":"GET",` +
+				`"httpUrl":"https://example.com","httpResponseBody":"PHA+YmxvY2NhdG8gww==",` +
+				`"httpResponseBodyEncoding":"base64","httpResponseBodyIsTruncated":false,` +
+				`"httpResponseBodyLength":13,"localAddr":"127.0.0.1:0","protocol":"tcp",` +
+				`"remoteAddr":"93.184.216.34:443","t":"2020-01-01T00:00:00Z"}` + "\n",
+		},
+
+		{
+			name:      "Logger not set",
+			newLogger: func(w io.Writer) *slog.Logger { return nil },
+			snapshot:  []byte("abc"),
+			expectLog: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			req, err := http.NewRequest("GET", "https://example.com", nil)
+			require.NoError(t, err)
+
+			MaybeLogResponseBodySnapshot(
+				tt.newLogger(&out),
+				netip.MustParseAddrPort("127.0.0.1:0"),
+				"tcp",
+				netip.MustParseAddrPort("93.184.216.34:443"),
+				req,
+				tt.snapshot,
+				tt.truncated,
+				time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			)
+			assert.Equal(t, tt.expectLog, out.String())
+		})
+	}
+}
+
+func TestMaybeLogBodyReadDone(t *testing.T) {
+	tests := []struct {
+		name      string
+		newLogger func(w io.Writer) *slog.Logger
+		err       error
+		expectLog string
+	}{
+		{
+			name:      "Logger set with success",
+			newLogger: newTestLogger,
+			err:       nil,
+			expectLog: `{"level":"INFO","msg":"httpBodyReadDone","err":null,"errClass":"",` +
+				`"httpMethod":"GET","httpUrl":"https://example.com","httpResponseBodyBytesRead":1234,` +
+				`"localAddr":"127.0.0.1:0","protocol":"tcp","remoteAddr":"93.184.216.34:443",` +
+				`"t0":"2020-01-01T00:00:00Z","t":"2020-01-01T00:00:01Z","duration":1000000000}` + "\n",
+		},
+
+		{
+			name:      "Logger set with error",
+			newLogger: newTestLogger,
+			err:       io.ErrUnexpectedEOF,
+			expectLog: `{"level":"INFO","msg":"httpBodyReadDone","err":"unexpected EOF","errClass":"EEOF",` +
+				`"httpMethod":"GET","httpUrl":"https://example.com","httpResponseBodyBytesRead":1234,` +
+				`"localAddr":"127.0.0.1:0","protocol":"tcp","remoteAddr":"93.184.216.34:443",` +
+				`"t0":"2020-01-01T00:00:00Z","t":"2020-01-01T00:00:01Z","duration":1000000000}` + "\n",
+		},
+
+		{
+			name:      "Logger not set",
+			newLogger: func(w io.Writer) *slog.Logger { return nil },
+			expectLog: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			req, err := http.NewRequest("GET", "https://example.com", nil)
+			require.NoError(t, err)
+
+			t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			MaybeLogBodyReadDone(
+				tt.newLogger(&out),
+				netip.MustParseAddrPort("127.0.0.1:0"),
+				"tcp",
+				netip.MustParseAddrPort("93.184.216.34:443"),
+				req,
+				1234,
+				tt.err,
+				t0,
+				t0.Add(time.Second),
+			)
+			assert.Equal(t, tt.expectLog, out.String())
+		})
+	}
+}
+
+func TestRoundTripperBodySnapshot(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		limit           int64
+		readAll         bool
+		expectSnapshot  string
+		expectTruncated bool
+		expectBytesRead float64
+		expectErr       any
+	}{
+		{
+			name:            "body shorter than the limit",
+			body:            "Hello, World!",
+			limit:           1024,
+			readAll:         true,
+			expectSnapshot:  "Hello, World!",
+			expectTruncated: false,
+			expectBytesRead: 13,
+			expectErr:       nil,
+		},
+
+		{
+			name:            "body exactly as long as the limit",
+			body:            "Hello, World!",
+			limit:           13,
+			readAll:         true,
+			expectSnapshot:  "Hello, World!",
+			expectTruncated: false,
+			expectBytesRead: 13,
+			expectErr:       nil,
+		},
+
+		{
+			name:            "body longer than the limit",
+			body:            strings.Repeat("A", 4096),
+			limit:           16,
+			readAll:         true,
+			expectSnapshot:  strings.Repeat("A", 16),
+			expectTruncated: true,
+			expectBytesRead: 4096,
+			expectErr:       nil,
+		},
+
+		{
+			name:            "body closed without reading",
+			body:            "Hello, World!",
+			limit:           1024,
+			readAll:         false,
+			expectSnapshot:  "",
+			expectTruncated: false,
+			expectBytesRead: 0,
+			expectErr:       ErrBodyClosedEarly.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			var out bytes.Buffer
+			rt := NewRoundTripper(http.DefaultTransport, slog.New(slog.NewJSONHandler(&out, nil)))
+			rt.MaxBodySnapshotSize = tt.limit
+			client := &http.Client{Transport: rt}
+
+			resp, err := client.Get(srv.URL)
+			require.NoError(t, err)
+			if tt.readAll {
+				data, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.body, string(data))
+			}
+			resp.Body.Close()
+
+			events := parseJSONLines(t, &out)
+			require.Len(t, events, 4)
+			snapshot, done := events[2], events[3]
+
+			assert.Equal(t, "httpResponseBodySnapshot", snapshot["msg"])
+			assert.Equal(t, tt.expectSnapshot, snapshot["httpResponseBody"])
+			assert.Equal(t, tt.expectTruncated, snapshot["httpResponseBodyIsTruncated"])
+			assert.Equal(t, float64(len(tt.expectSnapshot)), snapshot["httpResponseBodyLength"])
+
+			assert.Equal(t, "httpBodyReadDone", done["msg"])
+			assert.Equal(t, tt.expectBytesRead, done["httpResponseBodyBytesRead"])
+			assert.Equal(t, tt.expectErr, done["err"])
+		})
+	}
+
+	t.Run("multibyte character split at the limit", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<p>accesso bloccato per ordine dell'autorità</p>"))
+		}))
+		defer srv.Close()
+
+		var out bytes.Buffer
+		rt := NewRoundTripper(http.DefaultTransport, slog.New(slog.NewJSONHandler(&out, nil)))
+		rt.MaxBodySnapshotSize = 44 // in the middle of the "à" character
+		client := &http.Client{Transport: rt}
+
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		events := parseJSONLines(t, &out)
+		require.Len(t, events, 4)
+		snapshot := events[2]
+		assert.Equal(t, "<p>accesso bloccato per ordine dell'autorit", snapshot["httpResponseBody"])
+		assert.Equal(t, BodyEncodingUTF8, snapshot["httpResponseBodyEncoding"])
+		assert.Equal(t, true, snapshot["httpResponseBodyIsTruncated"])
+		assert.Equal(t, float64(43), snapshot["httpResponseBodyLength"])
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		var out bytes.Buffer
+		rt := &RoundTripper{
+			Logger:              slog.New(slog.NewJSONHandler(&out, nil)),
+			MaxBodySnapshotSize: 1024,
+			Transport: &mocks.HTTPTransport{
+				MockRoundTrip: func(req *http.Request) (*http.Response, error) {
+					body := io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(io.ErrUnexpectedEOF))
+					return &http.Response{StatusCode: 200, Body: io.NopCloser(body)}, nil
+				},
+			},
+		}
+
+		req, err := http.NewRequest("GET", "https://example.com", nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		resp.Body.Close()
+
+		events := parseJSONLines(t, &out)
+		require.Len(t, events, 4)
+		assert.Equal(t, "abc", events[2]["httpResponseBody"])
+		assert.Equal(t, "EEOF", events[3]["errClass"])
+		assert.Equal(t, float64(3), events[3]["httpResponseBodyBytesRead"])
+	})
+}
+
+// newTestLogger creates a JSON logger that does not log the record time.
+func newTestLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+}
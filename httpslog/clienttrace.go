@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"log/slog"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/rbmk-project/common/errclass"
+	"github.com/rbmk-project/common/netipx"
+)
+
+// NewClientTrace returns an [*httptrace.ClientTrace] that logs the HTTP
+// connection lifecycle using the given logger and context. If the logger
+// is nil, the returned trace does not log. If timeNow is nil, we use
+// [time.Now]. Use [httptrace.WithClientTrace] to compose the returned
+// trace with any other trace already present in the context.
+//
+// We emit the following events:
+//
+//   - `dnsLookupStart` and `dnsLookupDone` when resolving the host name;
+//
+//   - `connectStart` and `connectDone` for each dial attempt;
+//
+//   - `tlsHandshakeStart` and `tlsHandshakeDone`, where the latter
+//     includes the negotiated version, cipher suite, ALPN, and the
+//     peer certificate chain encoded using base64;
+//
+//   - `gotConn` when obtaining a connection, with reuse info;
+//
+//   - `wroteRequest` after writing the request;
+//
+//   - `gotFirstResponseByte` when the first response byte is available.
+//
+// The done events include `err` and `errClass`, as well as `t0`,
+// `t`, and `duration`, like [MaybeLogRoundTripDone] does.
+func NewClientTrace(ctx context.Context, logger *slog.Logger, timeNow func() time.Time) *httptrace.ClientTrace {
+	if logger == nil {
+		return &httptrace.ClientTrace{}
+	}
+	if timeNow == nil {
+		timeNow = time.Now
+	}
+	ct := &clientTracer{
+		connectT0: make(map[string]time.Time),
+		ctx:       ctx,
+		logger:    logger,
+		timeNow:   timeNow,
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:             ct.dnsStart,
+		DNSDone:              ct.dnsDone,
+		ConnectStart:         ct.connectStart,
+		ConnectDone:          ct.connectDone,
+		TLSHandshakeStart:    ct.tlsHandshakeStart,
+		TLSHandshakeDone:     ct.tlsHandshakeDone,
+		GotConn:              ct.gotConn,
+		WroteRequest:         ct.wroteRequest,
+		GotFirstResponseByte: ct.gotFirstResponseByte,
+	}
+}
+
+// clientTracer implements [NewClientTrace].
+type clientTracer struct {
+	// connectT0 maps each dial attempt to its start time.
+	connectT0 map[string]time.Time
+
+	// ctx is the context to use for logging.
+	ctx context.Context
+
+	// dnsHost is the host name we are resolving.
+	dnsHost string
+
+	// dnsT0 is when we started resolving.
+	dnsT0 time.Time
+
+	// logger is the logger to use.
+	logger *slog.Logger
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// timeNow returns the current time.
+	timeNow func() time.Time
+
+	// tlsT0 is when we started the TLS handshake.
+	tlsT0 time.Time
+}
+
+// log returns the logger to use, including the correlation IDs.
+func (ct *clientTracer) log() *slog.Logger {
+	return withCorrelation(ct.logger, ct.ctx)
+}
+
+func (ct *clientTracer) dnsStart(info httptrace.DNSStartInfo) {
+	t := ct.timeNow()
+	ct.mu.Lock()
+	ct.dnsHost, ct.dnsT0 = info.Host, t
+	ct.mu.Unlock()
+	ct.log().InfoContext(
+		ct.ctx,
+		"dnsLookupStart",
+		slog.String("dnsHost", info.Host),
+		slog.Time("t", t),
+	)
+}
+
+func (ct *clientTracer) dnsDone(info httptrace.DNSDoneInfo) {
+	t := ct.timeNow()
+	ct.mu.Lock()
+	host, t0 := ct.dnsHost, ct.dnsT0
+	ct.mu.Unlock()
+	addrs := make([]string, 0, len(info.Addrs))
+	for _, addr := range info.Addrs {
+		addrs = append(addrs, addr.String())
+	}
+	ct.log().InfoContext(
+		ct.ctx,
+		"dnsLookupDone",
+		slog.Any("err", info.Err),
+		slog.Any("errClass", errclass.New(info.Err)),
+		slog.String("dnsHost", host),
+		slog.Any("dnsAddrs", addrs),
+		slog.Bool("dnsCoalesced", info.Coalesced),
+		slog.Time("t0", t0),
+		slog.Time("t", t),
+		slog.Duration("duration", t.Sub(t0)),
+	)
+}
+
+func (ct *clientTracer) connectStart(network, addr string) {
+	t := ct.timeNow()
+	ct.mu.Lock()
+	ct.connectT0[network+" "+addr] = t
+	ct.mu.Unlock()
+	ct.log().InfoContext(
+		ct.ctx,
+		"connectStart",
+		slog.String("protocol", network),
+		slog.String("remoteAddr", addr),
+		slog.Time("t", t),
+	)
+}
+
+func (ct *clientTracer) connectDone(network, addr string, err error) {
+	t := ct.timeNow()
+	ct.mu.Lock()
+	t0 := ct.connectT0[network+" "+addr]
+	ct.mu.Unlock()
+	ct.log().InfoContext(
+		ct.ctx,
+		"connectDone",
+		slog.Any("err", err),
+		slog.Any("errClass", errclass.New(err)),
+		slog.String("protocol", network),
+		slog.String("remoteAddr", addr),
+		slog.Time("t0", t0),
+		slog.Time("t", t),
+		slog.Duration("duration", t.Sub(t0)),
+	)
+}
+
+func (ct *clientTracer) tlsHandshakeStart() {
+	t := ct.timeNow()
+	ct.mu.Lock()
+	ct.tlsT0 = t
+	ct.mu.Unlock()
+	ct.log().InfoContext(ct.ctx, "tlsHandshakeStart", slog.Time("t", t))
+}
+
+func (ct *clientTracer) tlsHandshakeDone(state tls.ConnectionState, err error) {
+	t := ct.timeNow()
+	ct.mu.Lock()
+	t0 := ct.tlsT0
+	ct.mu.Unlock()
+	certs := make([]string, 0, len(state.PeerCertificates))
+	for _, cert := range state.PeerCertificates {
+		certs = append(certs, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+	var cipherSuite, version string
+	if state.Version != 0 {
+		cipherSuite = tls.CipherSuiteName(state.CipherSuite)
+		version = tls.VersionName(state.Version)
+	}
+	ct.log().InfoContext(
+		ct.ctx,
+		"tlsHandshakeDone",
+		slog.Any("err", err),
+		slog.Any("errClass", errclass.New(err)),
+		slog.String("tlsCipherSuite", cipherSuite),
+		slog.String("tlsNegotiatedProtocol", state.NegotiatedProtocol),
+		slog.Any("tlsPeerCerts", certs),
+		slog.String("tlsServerName", state.ServerName),
+		slog.String("tlsVersion", version),
+		slog.Time("t0", t0),
+		slog.Time("t", t),
+		slog.Duration("duration", t.Sub(t0)),
+	)
+}
+
+func (ct *clientTracer) gotConn(info httptrace.GotConnInfo) {
+	ct.log().InfoContext(
+		ct.ctx,
+		"gotConn",
+		slog.Bool("connReused", info.Reused),
+		slog.Bool("connWasIdle", info.WasIdle),
+		slog.Duration("connIdleTime", info.IdleTime),
+		slog.String("localAddr", netipx.AddrToAddrPort(info.Conn.LocalAddr()).String()),
+		slog.String("protocol", netipx.AddrNetwork(info.Conn.LocalAddr(), "")),
+		slog.String("remoteAddr", netipx.AddrToAddrPort(info.Conn.RemoteAddr()).String()),
+		slog.Time("t", ct.timeNow()),
+	)
+}
+
+func (ct *clientTracer) wroteRequest(info httptrace.WroteRequestInfo) {
+	ct.log().InfoContext(
+		ct.ctx,
+		"wroteRequest",
+		slog.Any("err", info.Err),
+		slog.Any("errClass", errclass.New(info.Err)),
+		slog.Time("t", ct.timeNow()),
+	)
+}
+
+func (ct *clientTracer) gotFirstResponseByte() {
+	ct.log().InfoContext(ct.ctx, "gotFirstResponseByte", slog.Time("t", ct.timeNow()))
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rbmk-project/common/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventsByName indexes the events by name, keeping the first occurrence.
+func eventsByName(events []map[string]any) (map[string]map[string]any, []string) {
+	index := make(map[string]map[string]any)
+	var names []string
+	for _, event := range events {
+		name := event["msg"].(string)
+		names = append(names, name)
+		if _, found := index[name]; !found {
+			index[name] = event
+		}
+	}
+	return index, names
+}
+
+// positionOf returns the position of the first event with the given name.
+func positionOf(names []string, name string) int {
+	for idx, candidate := range names {
+		if candidate == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+func TestNewClientTrace(t *testing.T) {
+	t.Run("with a logger", func(t *testing.T) {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("Hello, World!"))
+		}))
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		defer srv.Close()
+
+		// make sure we need to resolve the host name
+		URL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+		_, port, err := net.SplitHostPort(URL.Host)
+		require.NoError(t, err)
+		URL.Host = net.JoinHostPort("localhost", port)
+
+		txp := srv.Client().Transport.(*http.Transport).Clone()
+		txp.TLSClientConfig.ServerName = "example.com"
+
+		var out bytes.Buffer
+		rt := NewRoundTripper(txp, slog.New(slog.NewJSONHandler(&out, nil)))
+		rt.LogClientTrace = true
+		client := &http.Client{Transport: rt}
+
+		// perform two requests to observe connection reuse
+		for idx := 0; idx < 2; idx++ {
+			resp, err := client.Get(URL.String())
+			require.NoError(t, err)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		events := parseJSONLines(t, &out)
+		index, names := eventsByName(events)
+
+		for _, name := range []string{
+			"dnsLookupStart",
+			"dnsLookupDone",
+			"connectStart",
+			"connectDone",
+			"tlsHandshakeStart",
+			"tlsHandshakeDone",
+			"gotConn",
+			"wroteRequest",
+			"gotFirstResponseByte",
+		} {
+			assert.Less(t, positionOf(names, name), positionOf(names, "httpRoundTripDone"), name)
+		}
+		assert.Less(t, positionOf(names, "dnsLookupDone"), positionOf(names, "connectStart"))
+		assert.Less(t, positionOf(names, "connectDone"), positionOf(names, "tlsHandshakeStart"))
+		assert.Less(t, positionOf(names, "tlsHandshakeDone"), positionOf(names, "wroteRequest"))
+
+		dnsDone := index["dnsLookupDone"]
+		assert.Equal(t, "localhost", dnsDone["dnsHost"])
+		assert.NotEmpty(t, dnsDone["dnsAddrs"])
+		assert.Equal(t, "", dnsDone["errClass"])
+
+		tlsDone := index["tlsHandshakeDone"]
+		assert.Equal(t, "", tlsDone["errClass"])
+		assert.Equal(t, "TLS 1.3", tlsDone["tlsVersion"])
+		assert.Equal(t, "h2", tlsDone["tlsNegotiatedProtocol"])
+		assert.Equal(t, "example.com", tlsDone["tlsServerName"])
+		assert.Len(t, tlsDone["tlsPeerCerts"], 1)
+		assert.NotEmpty(t, tlsDone["tlsCipherSuite"])
+
+		// the second request must reuse the connection
+		var gotConns []map[string]any
+		for _, event := range events {
+			if event["msg"] == "gotConn" {
+				gotConns = append(gotConns, event)
+			}
+		}
+		require.Len(t, gotConns, 2)
+		assert.Equal(t, false, gotConns[0]["connReused"])
+		assert.Equal(t, true, gotConns[1]["connReused"])
+		assert.Equal(t, "tcp", gotConns[1]["protocol"])
+	})
+
+	t.Run("with failures", func(t *testing.T) {
+		var out bytes.Buffer
+		t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		trace := NewClientTrace(
+			context.Background(),
+			slog.New(slog.NewJSONHandler(&out, nil)),
+			func() time.Time { return t0 },
+		)
+		trace.DNSStart(httptrace.DNSStartInfo{Host: "www.example.com"})
+		trace.DNSDone(httptrace.DNSDoneInfo{Err: errors.New("lookup www.example.com: no such host")})
+		trace.ConnectStart("tcp", "93.184.216.34:443")
+		trace.ConnectDone("tcp", "93.184.216.34:443", context.DeadlineExceeded)
+		trace.TLSHandshakeStart()
+		trace.TLSHandshakeDone(tls.ConnectionState{}, io.EOF)
+		trace.WroteRequest(httptrace.WroteRequestInfo{Err: net.ErrClosed})
+
+		index, _ := eventsByName(parseJSONLines(t, &out))
+		assert.Equal(t, "EDNS_NONAME", index["dnsLookupDone"]["errClass"])
+		assert.Equal(t, "ETIMEDOUT", index["connectDone"]["errClass"])
+		assert.Equal(t, "93.184.216.34:443", index["connectDone"]["remoteAddr"])
+		assert.Equal(t, "EEOF", index["tlsHandshakeDone"]["errClass"])
+		assert.Equal(t, "", index["tlsHandshakeDone"]["tlsVersion"])
+		assert.Equal(t, "EINTR", index["wroteRequest"]["errClass"])
+		assert.Equal(t, float64(0), index["connectDone"]["duration"])
+	})
+
+	t.Run("with a conn without addresses", func(t *testing.T) {
+		var out bytes.Buffer
+		trace := NewClientTrace(context.Background(), slog.New(slog.NewJSONHandler(&out, nil)), time.Now)
+		trace.GotConn(httptrace.GotConnInfo{Conn: &mocks.Conn{
+			MockLocalAddr:  func() net.Addr { return nil },
+			MockRemoteAddr: func() net.Addr { return nil },
+		}})
+
+		index, _ := eventsByName(parseJSONLines(t, &out))
+		assert.Equal(t, "", index["gotConn"]["protocol"])
+		assert.Equal(t, "[::]:0", index["gotConn"]["localAddr"])
+	})
+
+	t.Run("without a logger", func(t *testing.T) {
+		trace := NewClientTrace(context.Background(), nil, nil)
+		assert.Nil(t, trace.DNSStart)
+		assert.Nil(t, trace.GotConn)
+	})
+}
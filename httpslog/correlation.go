@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+
+	"github.com/rbmk-project/common/runtimex"
+)
+
+// correlation contains the correlation IDs of a round trip.
+type correlation struct {
+	// connID is the ID of the connection, set once we know it.
+	connID string
+
+	// mu provides mutual exclusion for connID.
+	mu sync.Mutex
+
+	// parentID is the ID of the round trip that caused this
+	// round trip (e.g., because of a redirect), if any.
+	parentID string
+
+	// roundTripID is the ID of the round trip.
+	roundTripID string
+}
+
+// correlationKey is the context key for the [*correlation].
+type correlationKey struct{}
+
+// NewRoundTripID returns a new random round trip ID.
+func NewRoundTripID() string {
+	var buf [8]byte
+	runtimex.Try1(rand.Read(buf[:]))
+	return hex.EncodeToString(buf[:])
+}
+
+// ContextWithRoundTripID returns a copy of the context carrying the
+// given round trip ID. When the context already carries a round trip ID,
+// it becomes the parent of the given one, thus linking nested operations.
+//
+// All the events logged by this package using a request whose context
+// carries a round trip ID include the `httpRoundTripId` field and, if
+// available, the `httpParentRoundTripId` and `connId` fields.
+func ContextWithRoundTripID(ctx context.Context, id string) context.Context {
+	return contextWithCorrelation(ctx, id, RoundTripIDFromContext(ctx))
+}
+
+// contextWithCorrelation returns a copy of the context carrying
+// a new [*correlation] with the given IDs.
+func contextWithCorrelation(ctx context.Context, id, parentID string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, &correlation{parentID: parentID, roundTripID: id})
+}
+
+// correlationFromContext returns the [*correlation] in the context or nil.
+func correlationFromContext(ctx context.Context) *correlation {
+	corr, _ := ctx.Value(correlationKey{}).(*correlation)
+	return corr
+}
+
+// RoundTripIDFromContext returns the round trip ID in the context
+// or an empty string if the context does not carry any.
+func RoundTripIDFromContext(ctx context.Context) string {
+	if corr := correlationFromContext(ctx); corr != nil {
+		return corr.roundTripID
+	}
+	return ""
+}
+
+// ConnIDFromContext returns the connection ID in the context or an empty
+// string if the context does not carry any or we don't know it yet.
+func ConnIDFromContext(ctx context.Context) string {
+	if corr := correlationFromContext(ctx); corr != nil {
+		corr.mu.Lock()
+		defer corr.mu.Unlock()
+		return corr.connID
+	}
+	return ""
+}
+
+// setConnID sets the connection ID of the round trip in the context,
+// if the context carries a round trip ID, otherwise it does nothing.
+func setConnID(ctx context.Context, id string) {
+	if corr := correlationFromContext(ctx); corr != nil {
+		corr.mu.Lock()
+		corr.connID = id
+		corr.mu.Unlock()
+	}
+}
+
+// withCorrelation returns a logger including the correlation IDs
+// in the context or the original logger if there are none.
+func withCorrelation(logger *slog.Logger, ctx context.Context) *slog.Logger {
+	corr := correlationFromContext(ctx)
+	if corr == nil {
+		return logger
+	}
+	args := []any{slog.String("httpRoundTripId", corr.roundTripID)}
+	if corr.parentID != "" {
+		args = append(args, slog.String("httpParentRoundTripId", corr.parentID))
+	}
+	if connID := ConnIDFromContext(ctx); connID != "" {
+		args = append(args, slog.String("connId", connID))
+	}
+	return logger.With(args...)
+}
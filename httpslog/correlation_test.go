@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRoundTripID(t *testing.T) {
+	id1, id2 := NewRoundTripID(), NewRoundTripID()
+	assert.Len(t, id1, 16)
+	assert.NotEqual(t, id1, id2)
+}
+
+func TestContextWithRoundTripID(t *testing.T) {
+	t.Run("without IDs", func(t *testing.T) {
+		ctx := context.Background()
+		assert.Equal(t, "", RoundTripIDFromContext(ctx))
+		assert.Equal(t, "", ConnIDFromContext(ctx))
+		setConnID(ctx, "127.0.0.1:54321->93.184.216.34:443") // should not panic
+
+		var out bytes.Buffer
+		withCorrelation(newTestLogger(&out), ctx).Info("event")
+		assert.Equal(t, `{"level":"INFO","msg":"event"}`+"\n", out.String())
+	})
+
+	t.Run("with nested IDs", func(t *testing.T) {
+		ctx := ContextWithRoundTripID(context.Background(), "aaaa")
+		ctx = ContextWithRoundTripID(ctx, "bbbb")
+		assert.Equal(t, "bbbb", RoundTripIDFromContext(ctx))
+		setConnID(ctx, "127.0.0.1:54321->93.184.216.34:443")
+		assert.Equal(t, "127.0.0.1:54321->93.184.216.34:443", ConnIDFromContext(ctx))
+
+		var out bytes.Buffer
+		withCorrelation(newTestLogger(&out), ctx).Info("event")
+		expect := `{"level":"INFO","msg":"event","httpRoundTripId":"bbbb","httpParentRoundTripId":"aaaa",` +
+			`"connId":"127.0.0.1:54321->93.184.216.34:443"}` + "\n"
+		assert.Equal(t, expect, out.String())
+	})
+}
+
+func TestRoundTripperCorrelation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/final", http.StatusFound)
+			return
+		}
+		w.Write([]byte("Hello, World!"))
+	}))
+	defer srv.Close()
+
+	var (
+		counter atomic.Int64
+		out     bytes.Buffer
+	)
+	rt := NewRoundTripper(http.DefaultTransport, slog.New(slog.NewJSONHandler(&out, nil)))
+	rt.LogClientTrace = true
+	rt.LogConnID = true
+	rt.MaxBodySnapshotSize = 1024
+	rt.NewRoundTripID = func() string {
+		return fmt.Sprintf("rt%d", counter.Add(1))
+	}
+	client := &http.Client{Transport: rt}
+
+	resp, err := client.Get(srv.URL + "/redirect")
+	require.NoError(t, err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	events := parseJSONLines(t, &out)
+	require.NotEmpty(t, events)
+	var final []map[string]any
+	for _, event := range events {
+		switch event["httpRoundTripId"] {
+		case "rt1":
+			assert.Nil(t, event["httpParentRoundTripId"], event["msg"])
+		case "rt2":
+			assert.Equal(t, "rt1", event["httpParentRoundTripId"], event["msg"])
+			final = append(final, event)
+		default:
+			t.Fatalf("unexpected event without a known round trip ID: %+v", event)
+		}
+	}
+
+	// all the events emitted after obtaining the connection must include the connId
+	index, _ := eventsByName(final)
+	for _, name := range []string{"httpRoundTripStart", "gotConn", "httpRoundTripDone", "httpBodyReadDone"} {
+		event := index[name]
+		require.NotNil(t, event, name)
+		assert.Equal(t, fmt.Sprintf("%s->%s", event["localAddr"], event["remoteAddr"]), event["connId"], name)
+	}
+}
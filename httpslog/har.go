@@ -0,0 +1,511 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HARVersion is the version of the HAR format we produce.
+const HARVersion = "1.2"
+
+// HAR is the root object of an HTTP Archive (HAR) 1.2 document.
+//
+// See http://www.softwareishard.com/blog/har-12-spec/.
+type HAR struct {
+	// Log contains the exported data.
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the log object of a [HAR] document.
+type HARLog struct {
+	// Version is the HAR format version (i.e., [HARVersion]).
+	Version string `json:"version"`
+
+	// Creator describes the software that created the log.
+	Creator HARCreator `json:"creator"`
+
+	// Entries contains an entry for each round trip.
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator describes the software that created a [HARLog].
+type HARCreator struct {
+	// Name is the name of the software.
+	Name string `json:"name"`
+
+	// Version is the version of the software.
+	Version string `json:"version"`
+}
+
+// harCreator is the [HARCreator] we use.
+var harCreator = HARCreator{Name: "github.com/rbmk-project/common/httpslog", Version: "(devel)"}
+
+// HAREntry is a round trip within a [HARLog].
+//
+// Besides the standard fields, we include the `_error` and `_errClass`
+// custom fields when the round trip failed. In such a case, the response
+// status is zero, like browsers do for failed requests.
+type HAREntry struct {
+	// StartedDateTime is when the round trip started.
+	StartedDateTime time.Time `json:"startedDateTime"`
+
+	// Time is the total round trip time in milliseconds.
+	Time float64 `json:"time"`
+
+	// Request describes the request.
+	Request HARRequest `json:"request"`
+
+	// Response describes the response.
+	Response HARResponse `json:"response"`
+
+	// Cache is always empty since we do not know about caching.
+	Cache struct{} `json:"cache"`
+
+	// Timings describes the round trip phases.
+	Timings HARTimings `json:"timings"`
+
+	// ServerIPAddress is the IP address of the server.
+	ServerIPAddress string `json:"serverIPAddress,omitempty"`
+
+	// Connection is the ID of the connection, if known.
+	Connection string `json:"connection,omitempty"`
+
+	// Error is the error that occurred, if any.
+	Error string `json:"_error,omitempty"`
+
+	// ErrClass is the [errclass] of the error, if any.
+	ErrClass string `json:"_errClass,omitempty"`
+}
+
+// HARRequest is the request of a [HAREntry].
+type HARRequest struct {
+	// Method is the request method.
+	Method string `json:"method"`
+
+	// URL is the absolute request URL.
+	URL string `json:"url"`
+
+	// HTTPVersion is the HTTP protocol version.
+	HTTPVersion string `json:"httpVersion"`
+
+	// Cookies is always empty since we redact cookies.
+	Cookies []HARNameValue `json:"cookies"`
+
+	// Headers contains the request headers.
+	Headers []HARNameValue `json:"headers"`
+
+	// QueryString contains the query string parameters.
+	QueryString []HARNameValue `json:"queryString"`
+
+	// HeadersSize is always -1 since we do not know it.
+	HeadersSize int64 `json:"headersSize"`
+
+	// BodySize is always -1 since we do not know it.
+	BodySize int64 `json:"bodySize"`
+}
+
+// HARResponse is the response of a [HAREntry].
+type HARResponse struct {
+	// Status is the response status code.
+	Status int `json:"status"`
+
+	// StatusText is the response status text.
+	StatusText string `json:"statusText"`
+
+	// HTTPVersion is the HTTP protocol version.
+	HTTPVersion string `json:"httpVersion"`
+
+	// Cookies is always empty since we redact cookies.
+	Cookies []HARNameValue `json:"cookies"`
+
+	// Headers contains the response headers.
+	Headers []HARNameValue `json:"headers"`
+
+	// Content describes the response body.
+	Content HARContent `json:"content"`
+
+	// RedirectURL is the content of the Location header.
+	RedirectURL string `json:"redirectURL"`
+
+	// HeadersSize is always -1 since we do not know it.
+	HeadersSize int64 `json:"headersSize"`
+
+	// BodySize is the number of body bytes we read or -1.
+	BodySize int64 `json:"bodySize"`
+}
+
+// HARContent describes the body of a [HARResponse].
+//
+// Besides the standard fields, we include the `_isTruncated` custom
+// field when Text contains a truncated snapshot of the body.
+type HARContent struct {
+	// Size is the number of body bytes we read.
+	Size int64 `json:"size"`
+
+	// MimeType is the content of the Content-Type header.
+	MimeType string `json:"mimeType"`
+
+	// Text is the body snapshot, if any.
+	Text string `json:"text,omitempty"`
+
+	// Encoding is "base64" when Text is base64 encoded.
+	Encoding string `json:"encoding,omitempty"`
+
+	// IsTruncated indicates whether Text is truncated.
+	IsTruncated bool `json:"_isTruncated,omitempty"`
+}
+
+// HARNameValue is a name-value pair (e.g., a header).
+type HARNameValue struct {
+	// Name is the name.
+	Name string `json:"name"`
+
+	// Value is the value.
+	Value string `json:"value"`
+}
+
+// HARTimings contains the duration in milliseconds of each phase of a
+// [HAREntry], where -1 means that a phase does not apply. The connect
+// phase includes the ssl phase, as mandated by the specification.
+type HARTimings struct {
+	// Blocked is the time spent waiting for a connection.
+	Blocked float64 `json:"blocked"`
+
+	// DNS is the time spent resolving the host name.
+	DNS float64 `json:"dns"`
+
+	// Connect is the time spent creating the connection.
+	Connect float64 `json:"connect"`
+
+	// Send is the time spent sending the request.
+	Send float64 `json:"send"`
+
+	// Wait is the time spent waiting for the response.
+	Wait float64 `json:"wait"`
+
+	// Receive is the time spent reading the response.
+	Receive float64 `json:"receive"`
+
+	// SSL is the time spent in the TLS handshake.
+	SSL float64 `json:"ssl"`
+}
+
+// ReadHAR reads a stream of JSON events emitted by this package and returns the
+// corresponding [*HAR] document. We create an entry for each `httpRoundTripDone`
+// event and complete it using the `httpResponseBodySnapshot` and `httpBodyReadDone`
+// events as well as the events emitted by [NewClientTrace]. We use the round trip
+// ID (see [ContextWithRoundTripID]) to correlate events, therefore we cannot
+// complete the entries of the round trips without ID. We drop the
+// [NewClientTrace] events of round trips lacking the `httpRoundTripDone` event.
+//
+// We ignore the events we do not know about, as well as the server side events.
+func ReadHAR(r io.Reader) (*HAR, error) {
+	builder := newHARBuilder()
+	decoder := json.NewDecoder(r)
+	for {
+		var event map[string]any
+		err := decoder.Decode(&event)
+		if errors.Is(err, io.EOF) {
+			return builder.HAR(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		builder.add(event)
+	}
+}
+
+// harTrace contains the [NewClientTrace] events of a round trip.
+type harTrace struct {
+	// connect is the connect duration in milliseconds or -1.
+	connect float64
+
+	// dns is the DNS lookup duration in milliseconds or -1.
+	dns float64
+
+	// firstByte is when we received the first response byte.
+	firstByte time.Time
+
+	// gotConn is when we obtained the connection.
+	gotConn time.Time
+
+	// ssl is the TLS handshake duration in milliseconds or -1.
+	ssl float64
+
+	// wroteRequest is when we finished writing the request.
+	wroteRequest time.Time
+}
+
+// harBuilder builds a [*HAR] from events.
+type harBuilder struct {
+	// entries contains the entries built so far.
+	entries []HAREntry
+
+	// index maps the round trip ID to the entry index.
+	index map[string]int
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// traces maps the round trip ID to the trace events.
+	traces map[string]*harTrace
+}
+
+// newHARBuilder creates a new [*harBuilder].
+func newHARBuilder() *harBuilder {
+	return &harBuilder{
+		entries: []HAREntry{},
+		index:   make(map[string]int),
+		traces:  make(map[string]*harTrace),
+	}
+}
+
+// HAR returns a [*HAR] containing a copy of the entries built so far. We drop
+// the traces of the round trips in progress, which will not have timings.
+func (hb *harBuilder) HAR() *HAR {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	clear(hb.traces)
+	entries := make([]HAREntry, len(hb.entries))
+	copy(entries, hb.entries)
+	return &HAR{Log: HARLog{Version: HARVersion, Creator: harCreator, Entries: entries}}
+}
+
+// harTraceEvents contains the events contributing to a [*harTrace].
+var harTraceEvents = map[string]bool{
+	"dnsLookupDone":        true,
+	"connectDone":          true,
+	"tlsHandshakeDone":     true,
+	"gotConn":              true,
+	"wroteRequest":         true,
+	"gotFirstResponseByte": true,
+}
+
+// add adds the given event to the [*harBuilder].
+func (hb *harBuilder) add(event map[string]any) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	// The trace events have meaning only along with a round trip ID. We only
+	// create a trace for the trace events, since other events, such as the
+	// body events, arrive after `httpRoundTripDone` deletes the trace.
+	msg := harString(event, "msg")
+	id := harString(event, "httpRoundTripId")
+	trace := hb.traces[id]
+	if id != "" && trace == nil && harTraceEvents[msg] {
+		trace = &harTrace{connect: -1, dns: -1, ssl: -1}
+		hb.traces[id] = trace
+	}
+
+	switch msg {
+	case "dnsLookupDone":
+		if trace != nil {
+			trace.dns = harMillis(event, "duration")
+		}
+
+	case "connectDone":
+		if trace != nil {
+			trace.connect = harMillis(event, "duration")
+		}
+
+	case "tlsHandshakeDone":
+		if trace != nil {
+			trace.ssl = harMillis(event, "duration")
+		}
+
+	case "gotConn":
+		if trace != nil {
+			trace.gotConn = harTime(event, "t")
+		}
+
+	case "wroteRequest":
+		if trace != nil {
+			trace.wroteRequest = harTime(event, "t")
+		}
+
+	case "gotFirstResponseByte":
+		if trace != nil {
+			trace.firstByte = harTime(event, "t")
+		}
+
+	case "httpRoundTripDone":
+		if id != "" {
+			delete(hb.traces, id)
+			hb.index[id] = len(hb.entries)
+		}
+		hb.entries = append(hb.entries, newHAREntry(event, trace))
+
+	case "httpResponseBodySnapshot":
+		if idx, found := hb.index[id]; found {
+			content := &hb.entries[idx].Response.Content
+			content.Text = harString(event, "httpResponseBody")
+			content.IsTruncated, _ = event["httpResponseBodyIsTruncated"].(bool)
+			if harString(event, "httpResponseBodyEncoding") == BodyEncodingBase64 {
+				content.Encoding = BodyEncodingBase64
+			}
+		}
+
+	case "httpBodyReadDone":
+		if idx, found := hb.index[id]; found {
+			entry := &hb.entries[idx]
+			count, _ := event["httpResponseBodyBytesRead"].(float64)
+			entry.Response.BodySize = int64(count)
+			entry.Response.Content.Size = int64(count)
+			receive := harMillis(event, "duration")
+			entry.Timings.Receive += receive
+			entry.Time += receive
+		}
+	}
+}
+
+// newHAREntry creates a new [HAREntry] from the `httpRoundTripDone`
+// event and the optional [*harTrace] of the same round trip.
+func newHAREntry(event map[string]any, trace *harTrace) HAREntry {
+	reqHeaders := harHeaders(event, "httpRequestHeaders")
+	respHeaders := harHeaders(event, "httpResponseHeaders")
+	statusCode, _ := event["httpResponseStatusCode"].(float64)
+	proto := harString(event, "httpResponseProto")
+	entry := HAREntry{
+		StartedDateTime: harTime(event, "t0"),
+		Request: HARRequest{
+			Method:      harString(event, "httpMethod"),
+			URL:         harString(event, "httpUrl"),
+			HTTPVersion: proto,
+			Cookies:     []HARNameValue{},
+			Headers:     reqHeaders,
+			QueryString: harQueryString(harString(event, "httpUrl")),
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: HARResponse{
+			Status:      int(statusCode),
+			StatusText:  http.StatusText(int(statusCode)),
+			HTTPVersion: proto,
+			Cookies:     []HARNameValue{},
+			Headers:     respHeaders,
+			Content:     HARContent{MimeType: harHeader(respHeaders, "Content-Type")},
+			RedirectURL: harHeader(respHeaders, "Location"),
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Connection: harString(event, "connId"),
+		Error:      harString(event, "err"),
+		ErrClass:   harString(event, "errClass"),
+	}
+	if addr, err := netip.ParseAddrPort(harString(event, "remoteAddr")); err == nil && addr.Addr().IsValid() &&
+		!addr.Addr().IsUnspecified() {
+		entry.ServerIPAddress = addr.Addr().String()
+	}
+
+	// Without a complete trace, we attribute the whole round trip to waiting.
+	t0, t := harTime(event, "t0"), harTime(event, "t")
+	entry.Timings = HARTimings{Blocked: -1, DNS: -1, Connect: -1, Wait: harMillis(event, "duration"), SSL: -1}
+	if trace != nil && !trace.gotConn.IsZero() && !trace.wroteRequest.IsZero() && !trace.firstByte.IsZero() {
+		entry.Timings = HARTimings{
+			DNS:     trace.dns,
+			Connect: trace.connect,
+			Send:    harSince(trace.wroteRequest, trace.gotConn),
+			Wait:    harSince(trace.firstByte, trace.wroteRequest),
+			Receive: harSince(t, trace.firstByte),
+			SSL:     trace.ssl,
+		}
+		if trace.connect >= 0 && trace.ssl >= 0 {
+			entry.Timings.Connect += trace.ssl
+		}
+		entry.Timings.Blocked = max(0, harSince(trace.gotConn, t0)-
+			max(0, entry.Timings.DNS)-max(0, entry.Timings.Connect))
+	}
+	timings := entry.Timings
+	for _, value := range []float64{timings.Blocked, timings.DNS, timings.Connect,
+		timings.Send, timings.Wait, timings.Receive} {
+		entry.Time += max(0, value)
+	}
+	return entry
+}
+
+// harString returns the string value of the given field or "".
+func harString(event map[string]any, key string) string {
+	value, _ := event[key].(string)
+	return value
+}
+
+// harTime returns the time value of the given field or the zero time.
+func harTime(event map[string]any, key string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, harString(event, key))
+	return t
+}
+
+// harMillis returns the milliseconds in the given nanoseconds field.
+func harMillis(event map[string]any, key string) float64 {
+	value, _ := event[key].(float64)
+	return value / float64(time.Millisecond)
+}
+
+// harSince returns the milliseconds elapsed between t0 and t.
+func harSince(t, t0 time.Time) float64 {
+	return max(0, float64(t.Sub(t0))/float64(time.Millisecond))
+}
+
+// harHeaders returns the given headers field as sorted name-value pairs.
+func harHeaders(event map[string]any, key string) []HARNameValue {
+	headers, _ := event[key].(map[string]any)
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := []HARNameValue{}
+	for _, name := range names {
+		values, _ := headers[name].([]any)
+		for _, value := range values {
+			if value, ok := value.(string); ok {
+				pairs = append(pairs, HARNameValue{Name: name, Value: value})
+			}
+		}
+	}
+	return pairs
+}
+
+// harHeader returns the first value of the given header or "".
+func harHeader(headers []HARNameValue, name string) string {
+	for _, pair := range headers {
+		if http.CanonicalHeaderKey(pair.Name) == name {
+			return pair.Value
+		}
+	}
+	return ""
+}
+
+// harQueryString returns the query string of the given URL as name-value
+// pairs, preserving the order in which they appear in the URL.
+func harQueryString(rawURL string) []HARNameValue {
+	pairs := []HARNameValue{}
+	URL, err := url.Parse(rawURL)
+	if err != nil || URL.RawQuery == "" {
+		return pairs
+	}
+	for _, param := range strings.Split(URL.RawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(param, "=")
+		if name, err := url.QueryUnescape(key); err == nil {
+			key = name
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		pairs = append(pairs, HARNameValue{Name: key, Value: value})
+	}
+	return pairs
+}
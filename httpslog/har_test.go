@@ -0,0 +1,233 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHAR(t *testing.T) {
+	t.Run("with a complete trace", func(t *testing.T) {
+		// create a clock advancing by 10 ms every time we read it
+		var (
+			now   = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			t0    = now
+			clock = func() time.Time {
+				now = now.Add(10 * time.Millisecond)
+				return now
+			}
+			out bytes.Buffer
+		)
+		logger := newTestLogger(&out)
+		ctx := ContextWithRoundTripID(context.Background(), "rt1")
+		req, err := http.NewRequestWithContext(ctx, "GET", "https://example.com/path?q=1&q=2&x=%20", nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept", "*/*")
+		conn1, conn2 := net.Pipe()
+		defer conn1.Close()
+		defer conn2.Close()
+
+		// emit the events in the order in which they would occur
+		trace := NewClientTrace(ctx, logger, clock)
+		trace.DNSStart(httptrace.DNSStartInfo{Host: "example.com"})
+		trace.DNSDone(httptrace.DNSDoneInfo{})
+		trace.ConnectStart("tcp", "93.184.216.34:443")
+		trace.ConnectDone("tcp", "93.184.216.34:443", nil)
+		trace.TLSHandshakeStart()
+		trace.TLSHandshakeDone(tls.ConnectionState{}, nil)
+		trace.GotConn(httptrace.GotConnInfo{Conn: conn1})
+		trace.WroteRequest(httptrace.WroteRequestInfo{})
+		trace.GotFirstResponseByte()
+		laddr := netip.MustParseAddrPort("127.0.0.1:54321")
+		raddr := netip.MustParseAddrPort("93.184.216.34:443")
+		resp := &http.Response{
+			StatusCode: 200,
+			Proto:      "HTTP/2.0",
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+		}
+		t1 := clock()
+		MaybeLogRoundTripDone(logger, laddr, "tcp", raddr, req, resp, nil, t0, t1)
+		MaybeLogResponseBodySnapshot(logger, laddr, "tcp", raddr, req, []byte{0xff, 0xfe}, true, t1)
+		MaybeLogBodyReadDone(logger, laddr, "tcp", raddr, req, 4096, nil, t1, clock())
+
+		har, err := ReadHAR(&out)
+		require.NoError(t, err)
+		assert.Equal(t, HARVersion, har.Log.Version)
+		require.Len(t, har.Log.Entries, 1)
+		entry := har.Log.Entries[0]
+
+		assert.Equal(t, t0, entry.StartedDateTime)
+		assert.Equal(t, HARTimings{
+			Blocked: 40,
+			DNS:     10,
+			Connect: 20,
+			Send:    10,
+			Wait:    10,
+			Receive: 20,
+			SSL:     10,
+		}, entry.Timings)
+		assert.Equal(t, float64(110), entry.Time)
+		assert.Equal(t, "93.184.216.34", entry.ServerIPAddress)
+		assert.Equal(t, "", entry.Error)
+
+		assert.Equal(t, "GET", entry.Request.Method)
+		assert.Equal(t, "HTTP/2.0", entry.Request.HTTPVersion)
+		assert.Equal(t, []HARNameValue{{Name: "Accept", Value: "*/*"}}, entry.Request.Headers)
+		assert.Equal(t, []HARNameValue{
+			{Name: "q", Value: "1"},
+			{Name: "q", Value: "2"},
+			{Name: "x", Value: " "},
+		}, entry.Request.QueryString)
+
+		assert.Equal(t, 200, entry.Response.Status)
+		assert.Equal(t, "OK", entry.Response.StatusText)
+		assert.Equal(t, int64(4096), entry.Response.BodySize)
+		assert.Equal(t, HARContent{
+			Size:        4096,
+			MimeType:    "text/plain",
+			Text:        "//4=",
+			Encoding:    BodyEncodingBase64,
+			IsTruncated: true,
+		}, entry.Response.Content)
+	})
+
+	t.Run("with a failure and without round trip ID", func(t *testing.T) {
+		var out bytes.Buffer
+		logger := newTestLogger(&out)
+		req, err := http.NewRequest("GET", "http://example.com/", nil)
+		require.NoError(t, err)
+		t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		addr := netip.AddrPortFrom(netip.IPv6Unspecified(), 0)
+		MaybeLogRoundTripStart(logger, addr, "", addr, req, t0)
+		MaybeLogRoundTripDone(logger, addr, "", addr, req, nil, io.ErrUnexpectedEOF, t0, t0.Add(time.Second))
+
+		har, err := ReadHAR(&out)
+		require.NoError(t, err)
+		require.Len(t, har.Log.Entries, 1)
+		entry := har.Log.Entries[0]
+		assert.Equal(t, 0, entry.Response.Status)
+		assert.Equal(t, "unexpected EOF", entry.Error)
+		assert.Equal(t, "EEOF", entry.ErrClass)
+		assert.Equal(t, "", entry.ServerIPAddress)
+		assert.Equal(t, HARTimings{Blocked: -1, DNS: -1, Connect: -1, Wait: 1000, SSL: -1}, entry.Timings)
+		assert.Equal(t, float64(1000), entry.Time)
+		assert.Equal(t, []HARNameValue{}, entry.Response.Headers)
+	})
+
+	t.Run("with repeated requests without round trip ID", func(t *testing.T) {
+		var out bytes.Buffer
+		logger := newTestLogger(&out)
+		req, err := http.NewRequest("GET", "http://example.com/", nil)
+		require.NoError(t, err)
+		t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		addr := netip.AddrPortFrom(netip.IPv6Unspecified(), 0)
+		resp := &http.Response{StatusCode: 200, Header: http.Header{}}
+		MaybeLogRoundTripDone(logger, addr, "tcp", addr, req, resp, nil, t0, t0)
+		MaybeLogRoundTripDone(logger, addr, "tcp", addr, req, resp, nil, t0, t0)
+		MaybeLogResponseBodySnapshot(logger, addr, "tcp", addr, req, []byte("first"), false, t0)
+		MaybeLogResponseBodySnapshot(logger, addr, "tcp", addr, req, []byte("second"), false, t0)
+
+		har, err := ReadHAR(&out)
+		require.NoError(t, err)
+		require.Len(t, har.Log.Entries, 2)
+		for _, entry := range har.Log.Entries {
+			assert.Equal(t, "", entry.Response.Content.Text)
+		}
+	})
+
+	t.Run("with a trace lacking httpRoundTripDone", func(t *testing.T) {
+		var out bytes.Buffer
+		ctx := ContextWithRoundTripID(context.Background(), "rt1")
+		trace := NewClientTrace(ctx, newTestLogger(&out), time.Now)
+		trace.DNSStart(httptrace.DNSStartInfo{Host: "example.com"})
+		trace.DNSDone(httptrace.DNSDoneInfo{})
+
+		builder := newHARBuilder()
+		for _, event := range parseJSONLines(t, &out) {
+			builder.add(event)
+		}
+		require.Len(t, builder.traces, 1)
+		assert.Empty(t, builder.HAR().Log.Entries)
+		assert.Empty(t, builder.traces)
+	})
+
+	t.Run("with invalid JSON", func(t *testing.T) {
+		har, err := ReadHAR(strings.NewReader("{"))
+		assert.Error(t, err)
+		assert.Nil(t, har)
+	})
+
+	t.Run("with no events", func(t *testing.T) {
+		har, err := ReadHAR(strings.NewReader(""))
+		require.NoError(t, err)
+		data, err := json.Marshal(har)
+		require.NoError(t, err)
+		expect := `{"log":{"version":"1.2","creator":{"name":"github.com/rbmk-project/common/httpslog",` +
+			`"version":"(devel)"},"entries":[]}}`
+		assert.Equal(t, expect, string(data))
+	})
+}
+
+func TestHARHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("Hello, World!"))
+	}))
+	defer srv.Close()
+
+	handler := NewHARHandler()
+	rt := NewRoundTripper(http.DefaultTransport, slog.New(handler).With("measurement", "test"))
+	rt.LogClientTrace = true
+	rt.LogConnID = true
+	rt.MaxBodySnapshotSize = 1024
+	client := &http.Client{Transport: rt}
+
+	// perform two requests to observe connection reuse
+	for idx := 0; idx < 2; idx++ {
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		assert.Len(t, handler.HAR().Log.Entries, idx+1)
+	}
+
+	entries := handler.HAR().Log.Entries
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Equal(t, 200, entry.Response.Status)
+		assert.Equal(t, "Hello, World!", entry.Response.Content.Text)
+		assert.Equal(t, int64(len("Hello, World!")), entry.Response.Content.Size)
+		assert.Equal(t, "127.0.0.1", entry.ServerIPAddress)
+		assert.NotEmpty(t, entry.Connection)
+		timings := entry.Timings
+		assert.GreaterOrEqual(t, timings.Blocked, float64(0))
+		assert.GreaterOrEqual(t, timings.Send, float64(0))
+		assert.GreaterOrEqual(t, timings.Wait, float64(0))
+		assert.GreaterOrEqual(t, timings.Receive, float64(0))
+	}
+	assert.GreaterOrEqual(t, entries[0].Timings.Connect, float64(0))
+	assert.Equal(t, float64(-1), entries[0].Timings.SSL)
+	assert.Equal(t, float64(-1), entries[1].Timings.Connect)
+	assert.Equal(t, entries[0].Connection, entries[1].Connection)
+
+	// make sure we do not leak the per round trip traces
+	handler.builder.mu.Lock()
+	assert.Empty(t, handler.builder.traces)
+	handler.builder.mu.Unlock()
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+)
+
+// HARHandler is an [slog.Handler] that builds a [*HAR] document in memory
+// from the events emitted by this package, as round trips complete, using
+// the same algorithm used by [ReadHAR]. Use [*HARHandler.HAR] to obtain a
+// snapshot of the document built so far.
+//
+// Construct using [NewHARHandler].
+type HARHandler struct {
+	// builder is the shared [*harBuilder].
+	builder *harBuilder
+
+	// handler is the [*slog.JSONHandler] we use to serialize the
+	// records, which also takes care of attributes and groups.
+	handler slog.Handler
+}
+
+var _ slog.Handler = &HARHandler{}
+
+// NewHARHandler creates a new [*HARHandler].
+func NewHARHandler() *HARHandler {
+	builder := newHARBuilder()
+	return &HARHandler{
+		builder: builder,
+		handler: slog.NewJSONHandler((*harWriter)(builder), nil),
+	}
+}
+
+// HAR returns a [*HAR] containing the round trips completed so far. We drop
+// the [NewClientTrace] events of the round trips in progress, whose entries
+// will lack the corresponding timings, so call this method once they are done.
+func (h *HARHandler) HAR() *HAR {
+	return h.builder.HAR()
+}
+
+// Enabled implements [slog.Handler].
+func (h *HARHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle implements [slog.Handler].
+func (h *HARHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handler.Handle(ctx, record)
+}
+
+// WithAttrs implements [slog.Handler].
+func (h *HARHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &HARHandler{builder: h.builder, handler: h.handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements [slog.Handler].
+func (h *HARHandler) WithGroup(name string) slog.Handler {
+	return &HARHandler{builder: h.builder, handler: h.handler.WithGroup(name)}
+}
+
+// harWriter adapts a [*harBuilder] to be an [io.Writer] receiving
+// the JSON lines emitted by a [*slog.JSONHandler].
+type harWriter harBuilder
+
+// Write implements [io.Writer].
+func (w *harWriter) Write(data []byte) (int, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var event map[string]any
+		if err := decoder.Decode(&event); err != nil {
+			return 0, err
+		}
+		(*harBuilder)(w).add(event)
+	}
+	return len(data), nil
+}
@@ -1,6 +1,17 @@
 // SPDX-License-Identifier: GPL-3.0-or-later
 
-// Package httpslog implements structured logging for HTTP clients.
+// Package httpslog implements structured logging for HTTP clients and servers.
+//
+// Before logging, we scrub sensitive information from the URL, the headers,
+// and the errors using the [*Redactor] in the request context (see
+// [ContextWithRedactor]) or a default one created using [NewRedactor].
+//
+// When the request context carries a round trip ID (see
+// [ContextWithRoundTripID]), we include it in all the events, so that
+// concurrent round trips can be told apart and correlated.
+//
+// Use [ReadHAR] to convert the emitted JSON events to an HTTP Archive
+// (HAR) document or [NewHARHandler] to build such a document live.
 package httpslog
 
 import (
@@ -23,12 +34,14 @@ func MaybeLogRoundTripStart(
 	t0 time.Time,
 ) {
 	if logger != nil {
+		logger = withCorrelation(logger, req.Context())
+		redactor := redactorFromContext(req.Context())
 		logger.InfoContext(
 			req.Context(),
 			"httpRoundTripStart",
 			slog.String("httpMethod", req.Method),
-			slog.String("httpUrl", req.URL.String()),
-			slog.Any("httpRequestHeaders", req.Header),
+			slog.String("httpUrl", redactor.URL(req.URL)),
+			slog.Any("httpRequestHeaders", redactor.Header(req.Header)),
 			slog.String("localAddr", localAddr.String()),
 			slog.String("protocol", protocol),
 			slog.String("remoteAddr", remoteAddr.String()),
@@ -39,6 +52,13 @@ func MaybeLogRoundTripStart(
 
 // MaybeLogRoundTripDone logs the end of a round trip if the given
 // logger is not nil, otherwise it does nothing.
+//
+// Both the success and the failure paths emit the same fields. On
+// failure, `err` and `errClass` are set and the response fields are
+// zero valued. On success, `err` is null, `errClass` is empty, and
+// `httpResponseProto` contains the negotiated HTTP protocol (e.g.,
+// `HTTP/1.1` or `HTTP/2.0`). We always emit `t0`, `t`, and the
+// `duration` computed as the difference between `t` and `t0`.
 func MaybeLogRoundTripDone(
 	logger *slog.Logger,
 	localAddr netip.AddrPort,
@@ -51,35 +71,35 @@ func MaybeLogRoundTripDone(
 	t time.Time,
 ) {
 	if logger != nil {
-		if err != nil {
-			logger.InfoContext(
-				req.Context(),
-				"httpRoundTripDone",
-				slog.Any("err", err),
-				slog.Any("errClass", errclass.New(err)),
-				slog.String("httpMethod", req.Method),
-				slog.String("httpUrl", req.URL.String()),
-				slog.Any("httpRequestHeaders", req.Header),
-				slog.String("localAddr", localAddr.String()),
-				slog.String("protocol", protocol),
-				slog.String("remoteAddr", remoteAddr.String()),
-				slog.Time("t0", t0),
-				slog.Time("t", t),
-			)
-			return
+		logger = withCorrelation(logger, req.Context())
+		redactor := redactorFromContext(req.Context())
+		var (
+			respHeaders    http.Header
+			respProto      string
+			respStatusCode int
+		)
+		if err == nil && resp != nil {
+			respHeaders = redactor.Header(resp.Header)
+			respProto = resp.Proto
+			respStatusCode = resp.StatusCode
 		}
 		logger.InfoContext(
 			req.Context(),
 			"httpRoundTripDone",
+			slog.Any("err", redactor.Error(err)),
+			slog.Any("errClass", errclass.New(err)),
 			slog.String("httpMethod", req.Method),
-			slog.String("httpUrl", req.URL.String()),
-			slog.Any("httpRequestHeaders", req.Header),
-			slog.Int("httpResponseStatusCode", resp.StatusCode),
-			slog.Any("httpResponseHeaders", resp.Header),
+			slog.String("httpUrl", redactor.URL(req.URL)),
+			slog.Any("httpRequestHeaders", redactor.Header(req.Header)),
+			slog.Int("httpResponseStatusCode", respStatusCode),
+			slog.Any("httpResponseHeaders", respHeaders),
+			slog.String("httpResponseProto", respProto),
 			slog.String("localAddr", localAddr.String()),
 			slog.String("protocol", protocol),
 			slog.String("remoteAddr", remoteAddr.String()),
-			slog.Time("t", t0),
+			slog.Time("t0", t0),
+			slog.Time("t", t),
+			slog.Duration("duration", t.Sub(t0)),
 		)
 	}
 }
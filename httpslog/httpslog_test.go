@@ -97,11 +97,11 @@ func TestMaybeLogRoundTripDone(t *testing.T) {
 			},
 			withError:  false,
 			expectTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
-			expectLog: `{"level":"INFO","msg":"httpRoundTripDone","httpMethod":"GET",` +
-				`"httpUrl":"https://example.com","httpRequestHeaders":{},` +
-				`"httpResponseStatusCode":200,"httpResponseHeaders":{},` +
+			expectLog: `{"level":"INFO","msg":"httpRoundTripDone","err":null,"errClass":"",` +
+				`"httpMethod":"GET","httpUrl":"https://example.com","httpRequestHeaders":{},` +
+				`"httpResponseStatusCode":200,"httpResponseHeaders":{},"httpResponseProto":"HTTP/1.1",` +
 				`"localAddr":"127.0.0.1:0","protocol":"tcp","remoteAddr":"93.184.216.34:443",` +
-				`"t":"2020-01-01T00:00:00Z"}` + "\n",
+				`"t0":"2020-01-01T00:00:00Z","t":"2020-01-01T00:00:01Z","duration":1000000000}` + "\n",
 		},
 		{
 			name: "Logger set with error",
@@ -120,8 +120,10 @@ func TestMaybeLogRoundTripDone(t *testing.T) {
 			expectTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
 			expectLog: `{"level":"INFO","msg":"httpRoundTripDone","err":"assert.AnError general error for testing",` +
 				`"errClass":"EGENERIC","httpMethod":"GET","httpUrl":"https://example.com",` +
-				`"httpRequestHeaders":{},"localAddr":"127.0.0.1:0","protocol":"tcp",` +
-				`"remoteAddr":"93.184.216.34:443","t0":"2020-01-01T00:00:00Z","t":"2020-01-01T00:00:00Z"}` + "\n",
+				`"httpRequestHeaders":{},"httpResponseStatusCode":0,"httpResponseHeaders":null,` +
+				`"httpResponseProto":"","localAddr":"127.0.0.1:0","protocol":"tcp",` +
+				`"remoteAddr":"93.184.216.34:443","t0":"2020-01-01T00:00:00Z","t":"2020-01-01T00:00:01Z",` +
+				`"duration":1000000000}` + "\n",
 		},
 		{
 			name:       "Logger not set",
@@ -146,6 +148,7 @@ func TestMaybeLogRoundTripDone(t *testing.T) {
 			if !tt.withError {
 				resp = &http.Response{
 					StatusCode: 200,
+					Proto:      "HTTP/1.1",
 					Header:     make(http.Header),
 				}
 			} else {
@@ -164,7 +167,7 @@ func TestMaybeLogRoundTripDone(t *testing.T) {
 				resp,
 				roundTripErr,
 				tt.expectTime,
-				tt.expectTime,
+				tt.expectTime.Add(time.Second),
 			)
 
 			actualLog := out.String()
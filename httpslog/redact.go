@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue is the value replacing redacted information.
+const RedactedValue = "REDACTED"
+
+// Redactor scrubs sensitive information from HTTP headers and URLs
+// before we log them. Construct using [NewRedactor] to obtain a safe
+// default deny-list, which you can further customize.
+//
+// The zero value is ready to use and does not redact anything.
+type Redactor struct {
+	// HeaderNames contains the names of the headers whose values
+	// we should redact. The match is case-insensitive.
+	HeaderNames []string
+
+	// HeaderValuePatterns contains the patterns matching the
+	// portions of header values that we should redact.
+	HeaderValuePatterns []*regexp.Regexp
+
+	// QueryParams contains the names of the URL query parameters whose
+	// values we should redact. The match is case-insensitive.
+	QueryParams []string
+
+	// RedactUserinfo indicates whether to redact the URL userinfo.
+	RedactUserinfo bool
+}
+
+// NewRedactor creates a new [*Redactor] using a safe default deny-list.
+func NewRedactor() *Redactor {
+	return &Redactor{
+		HeaderNames: []string{
+			"Authorization",
+			"Cookie",
+			"Proxy-Authorization",
+			"Set-Cookie",
+			"X-Api-Key",
+			"X-Auth-Token",
+		},
+		HeaderValuePatterns: []*regexp.Regexp{
+			// JSON Web Tokens (e.g., inside custom headers)
+			regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		},
+		QueryParams: []string{
+			"access_token",
+			"api_key",
+			"apikey",
+			"auth",
+			"password",
+			"secret",
+			"token",
+		},
+		RedactUserinfo: true,
+	}
+}
+
+// defaultRedactor is the [*Redactor] used when the context does not contain one.
+var defaultRedactor = NewRedactor()
+
+// redactorContextKey is the context key for the [*Redactor].
+type redactorContextKey struct{}
+
+// ContextWithRedactor returns a copy of the context using the given
+// [*Redactor] when logging requests using such a context. By default, we
+// use a [*Redactor] constructed using [NewRedactor]. To disable redaction,
+// use a zero-initialized [*Redactor].
+func ContextWithRedactor(ctx context.Context, redactor *Redactor) context.Context {
+	return context.WithValue(ctx, redactorContextKey{}, redactor)
+}
+
+// redactorFromContext returns the [*Redactor] to use with the given context.
+func redactorFromContext(ctx context.Context) *Redactor {
+	if redactor, ok := ctx.Value(redactorContextKey{}).(*Redactor); ok && redactor != nil {
+		return redactor
+	}
+	return defaultRedactor
+}
+
+// Header returns a redacted copy of the given [http.Header].
+func (r *Redactor) Header(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+	output := make(http.Header, len(header))
+	for name, values := range header {
+		redacted := make([]string, 0, len(values))
+		for _, value := range values {
+			redacted = append(redacted, r.headerValue(name, value))
+		}
+		output[name] = redacted
+	}
+	return output
+}
+
+// headerValue returns the redacted value of the given header.
+func (r *Redactor) headerValue(name, value string) string {
+	for _, candidate := range r.HeaderNames {
+		if strings.EqualFold(candidate, name) {
+			return RedactedValue
+		}
+	}
+	for _, pattern := range r.HeaderValuePatterns {
+		value = pattern.ReplaceAllLiteralString(value, RedactedValue)
+	}
+	return value
+}
+
+// URL returns the redacted string representation of the given [*url.URL].
+//
+// We preserve the order of the query parameters.
+func (r *Redactor) URL(URL *url.URL) string {
+	redacted := *URL
+	if r.RedactUserinfo && redacted.User != nil {
+		redacted.User = url.User(RedactedValue)
+	}
+	if redacted.RawQuery != "" && len(r.QueryParams) > 0 {
+		redacted.RawQuery = r.rawQuery(redacted.RawQuery)
+	}
+	return redacted.String()
+}
+
+// Error returns an error suitable for logging whose message does not contain
+// the sensitive information included in the URL of a [*url.Error], which
+// the HTTP client uses to wrap errors and contains the full request URL.
+//
+// The returned error wraps the same errors wrapped by the original error.
+func (r *Redactor) Error(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	URL, perr := url.Parse(urlErr.URL)
+	if perr != nil {
+		return err
+	}
+	redactedURL := r.URL(URL)
+	if err == error(urlErr) {
+		return &url.Error{Op: urlErr.Op, URL: redactedURL, Err: urlErr.Err}
+	}
+	return &redactedError{
+		err:     err,
+		message: strings.ReplaceAll(err.Error(), urlErr.URL, redactedURL),
+	}
+}
+
+// redactedError is an error with a redacted message.
+type redactedError struct {
+	err     error
+	message string
+}
+
+// Error implements error.
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+// Unwrap returns the original error.
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// rawQuery returns the redacted raw query string.
+func (r *Redactor) rawQuery(rawQuery string) string {
+	params := strings.Split(rawQuery, "&")
+	for idx, param := range params {
+		key, _, found := strings.Cut(param, "=")
+		if !found {
+			continue
+		}
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		for _, candidate := range r.QueryParams {
+			if strings.EqualFold(candidate, name) {
+				params[idx] = key + "=" + RedactedValue
+				break
+			}
+		}
+	}
+	return strings.Join(params, "&")
+}
@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/rbmk-project/common/httpconntrace"
+)
+
+// RoundTripper is an [http.RoundTripper] that automatically logs each
+// round trip using [MaybeLogRoundTripStart] and [MaybeLogRoundTripDone].
+//
+// We use [net/http/httptrace] to discover the connection endpoints, composing
+// our trace with any other trace that may be present in the request context.
+// We emit the `httpRoundTripStart` event as soon as we know the connection
+// used by the request, or right before the `httpRoundTripDone` event when the
+// round trip fails before obtaining a connection.
+//
+// We assign each round trip a new ID using NewRoundTripID and store it into
+// the request context (see [ContextWithRoundTripID]) such that all the events
+// related to the round trip, including the ones emitted by [NewClientTrace],
+// include the `httpRoundTripId` field. When the request context already
+// carries a round trip ID, or the request follows a redirect performed by an
+// [*http.Client], the previous ID becomes the `httpParentRoundTripId`.
+//
+// The zero value is ready to use and does not log.
+type RoundTripper struct {
+	// LogConnID OPTIONALLY enables including the `connId` field, obtained
+	// using [*httpconntrace.Endpoints.ID], in the events emitted after
+	// we know which connection the round trip is using.
+	LogConnID bool
+
+	// LogClientTrace OPTIONALLY enables logging the HTTP connection
+	// lifecycle events emitted by [NewClientTrace].
+	LogClientTrace bool
+
+	// Logger is the OPTIONAL logger to use. If nil, we don't log.
+	Logger *slog.Logger
+
+	// MaxBodySnapshotSize is the OPTIONAL maximum number of response body
+	// bytes to capture. When positive, we wrap the response body to emit the
+	// `httpResponseBodySnapshot` and `httpBodyReadDone` events when the caller
+	// finishes reading or closes the body. The caller still sees the whole
+	// body. When zero or negative, we do not capture the response body.
+	MaxBodySnapshotSize int64
+
+	// NewRoundTripID is the OPTIONAL function to generate round
+	// trip IDs. If nil, we use the [NewRoundTripID] function.
+	NewRoundTripID func() string
+
+	// Redactor is the OPTIONAL [*Redactor] to use. If nil, we use the
+	// [*Redactor] in the request context or the default one.
+	Redactor *Redactor
+
+	// TimeNow is the OPTIONAL function to get the current time.
+	// If nil, we use [time.Now].
+	TimeNow func() time.Time
+
+	// Transport is the OPTIONAL underlying [http.RoundTripper].
+	// If nil, we use [http.DefaultTransport].
+	Transport http.RoundTripper
+}
+
+var _ http.RoundTripper = &RoundTripper{}
+
+// NewRoundTripper creates a new [*RoundTripper] using the given
+// underlying transport and logger.
+func NewRoundTripper(txp http.RoundTripper, logger *slog.Logger) *RoundTripper {
+	return &RoundTripper{Logger: logger, TimeNow: time.Now, Transport: txp}
+}
+
+// timeNow returns the current time using TimeNow or [time.Now].
+func (rt *RoundTripper) timeNow() time.Time {
+	if rt.TimeNow != nil {
+		return rt.TimeNow()
+	}
+	return time.Now()
+}
+
+// newRoundTripID returns a new ID using NewRoundTripID or [NewRoundTripID].
+func (rt *RoundTripper) newRoundTripID() string {
+	if rt.NewRoundTripID != nil {
+		return rt.NewRoundTripID()
+	}
+	return NewRoundTripID()
+}
+
+// transport returns Transport or [http.DefaultTransport].
+func (rt *RoundTripper) transport() http.RoundTripper {
+	if rt.Transport != nil {
+		return rt.Transport
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Prepare to collect info in a goroutine-safe way.
+	var (
+		laddr    netip.AddrPort
+		mu       sync.Mutex
+		protocol string
+		raddr    netip.AddrPort
+		started  bool
+		t0       = rt.timeNow()
+	)
+
+	// logStart logs the round trip start at most once.
+	logStart := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !started {
+			started = true
+			MaybeLogRoundTripStart(rt.Logger, laddr, protocol, raddr, req, t0)
+		}
+	}
+
+	// Possibly override the redactor for this request.
+	if rt.Redactor != nil {
+		req = req.WithContext(ContextWithRedactor(req.Context(), rt.Redactor))
+	}
+
+	// Assign an ID to this round trip, linking it to the parent
+	// round trip, which is either in the context or the one
+	// that returned the redirect response we're following.
+	parentID := RoundTripIDFromContext(req.Context())
+	if parentID == "" && req.Response != nil && req.Response.Request != nil {
+		parentID = RoundTripIDFromContext(req.Response.Request.Context())
+	}
+	req = req.WithContext(contextWithCorrelation(req.Context(), rt.newRoundTripID(), parentID))
+
+	// Possibly log the connection lifecycle events.
+	if rt.LogClientTrace {
+		lifecycle := NewClientTrace(req.Context(), rt.Logger, rt.timeNow)
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), lifecycle))
+	}
+
+	// Compose our trace with the existing context trace, if any.
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			epnts := httpconntrace.NewEndpoints(info.Conn)
+			mu.Lock()
+			if !started {
+				laddr, raddr = epnts.LocalAddr, epnts.RemoteAddr
+				protocol = epnts.Protocol
+				if rt.LogConnID {
+					setConnID(req.Context(), epnts.ID())
+				}
+			}
+			mu.Unlock()
+			logStart()
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	// Perform the round trip proper.
+	resp, err := rt.transport().RoundTrip(req)
+	t := rt.timeNow()
+
+	// Make sure we always emit a start event before the done event.
+	logStart()
+
+	// Read the endpoints while holding the mutex.
+	mu.Lock()
+	defer mu.Unlock()
+	MaybeLogRoundTripDone(rt.Logger, laddr, protocol, raddr, req, resp, err, t0, t)
+
+	// Possibly arrange for capturing a snapshot of the body. We do not wrap
+	// the body of protocol switches, which is also an [io.Writer].
+	if err == nil && rt.MaxBodySnapshotSize > 0 && resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body = &bodySnapshotter{
+			body:       resp.Body,
+			limit:      rt.MaxBodySnapshotSize,
+			localAddr:  laddr,
+			logger:     rt.Logger,
+			protocol:   protocol,
+			remoteAddr: raddr,
+			req:        req,
+			t0:         t,
+			timeNow:    rt.timeNow,
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/rbmk-project/common/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseJSONLines parses the JSON log lines written into the buffer.
+func parseJSONLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var events []map[string]any
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var event map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	require.NoError(t, scanner.Err())
+	return events
+}
+
+func TestRoundTripper(t *testing.T) {
+	t.Run("successful round trips", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			newServer   func(handler http.Handler) *httptest.Server
+			expectProto string
+		}{
+			{
+				name:        "HTTP/1.1",
+				newServer:   httptest.NewServer,
+				expectProto: "HTTP/1.1",
+			},
+
+			{
+				name: "HTTP/2",
+				newServer: func(handler http.Handler) *httptest.Server {
+					srv := httptest.NewUnstartedServer(handler)
+					srv.EnableHTTP2 = true
+					srv.StartTLS()
+					return srv
+				},
+				expectProto: "HTTP/2.0",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				srv := tt.newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("Hello, World!"))
+				}))
+				defer srv.Close()
+
+				var out bytes.Buffer
+				logger := slog.New(slog.NewJSONHandler(&out, nil))
+				client := &http.Client{Transport: NewRoundTripper(srv.Client().Transport, logger)}
+
+				resp, err := client.Get(srv.URL)
+				require.NoError(t, err)
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+
+				events := parseJSONLines(t, &out)
+				require.Len(t, events, 2)
+
+				start, done := events[0], events[1]
+				assert.Equal(t, "httpRoundTripStart", start["msg"])
+				assert.Equal(t, "httpRoundTripDone", done["msg"])
+
+				serverAddr := srv.Listener.Addr().String()
+				for _, event := range events {
+					assert.Equal(t, "tcp", event["protocol"])
+					assert.Equal(t, serverAddr, event["remoteAddr"])
+					localAddr, err := netip.ParseAddrPort(event["localAddr"].(string))
+					assert.NoError(t, err)
+					assert.True(t, localAddr.IsValid())
+				}
+
+				assert.Equal(t, float64(200), done["httpResponseStatusCode"])
+				assert.Equal(t, tt.expectProto, done["httpResponseProto"])
+				assert.Equal(t, start["t"], done["t0"])
+				assert.GreaterOrEqual(t, done["duration"], float64(0))
+			})
+		}
+	})
+
+	t.Run("failure before obtaining a connection", func(t *testing.T) {
+		var out bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&out, nil))
+		t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		rt := &RoundTripper{
+			Logger:  logger,
+			TimeNow: func() time.Time { return t0 },
+			Transport: &mocks.HTTPTransport{
+				MockRoundTrip: func(req *http.Request) (*http.Response, error) {
+					return nil, io.ErrUnexpectedEOF
+				},
+			},
+		}
+
+		req, err := http.NewRequest("GET", "https://example.com", nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.Nil(t, resp)
+
+		events := parseJSONLines(t, &out)
+		require.Len(t, events, 2)
+		assert.Equal(t, "httpRoundTripStart", events[0]["msg"])
+		assert.Equal(t, "2020-01-01T00:00:00Z", events[0]["t"])
+		assert.Equal(t, "httpRoundTripDone", events[1]["msg"])
+		assert.Equal(t, "EEOF", events[1]["errClass"])
+	})
+
+	t.Run("zero value does not log", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer srv.Close()
+
+		client := &http.Client{Transport: &RoundTripper{}}
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+}
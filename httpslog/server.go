@@ -0,0 +1,255 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"github.com/rbmk-project/common/errclass"
+	"github.com/rbmk-project/common/netipx"
+)
+
+// serverRequestURL reconstructs the absolute URL of a server request
+// such that it is comparable to the URL logged by clients.
+func serverRequestURL(req *http.Request) *url.URL {
+	URL := *req.URL
+	URL.Host = req.Host
+	URL.Scheme = "http"
+	if req.TLS != nil {
+		URL.Scheme = "https"
+	}
+	return &URL
+}
+
+// MaybeLogServerRequestStart logs the start of a server request if the
+// given logger is not nil, otherwise it does nothing.
+//
+// We use the same field names used by [MaybeLogRoundTripStart] and we
+// reconstruct the absolute request URL using the Host header and
+// whether the request used TLS, so client and server logs can be
+// correlated. The `httpRequestProto` field contains the request Proto.
+func MaybeLogServerRequestStart(
+	logger *slog.Logger,
+	localAddr netip.AddrPort,
+	protocol string,
+	remoteAddr netip.AddrPort,
+	req *http.Request,
+	t0 time.Time,
+) {
+	if logger != nil {
+		logger = withCorrelation(logger, req.Context())
+		redactor := redactorFromContext(req.Context())
+		logger.InfoContext(
+			req.Context(),
+			"httpServerRequestStart",
+			slog.String("httpMethod", req.Method),
+			slog.String("httpUrl", redactor.URL(serverRequestURL(req))),
+			slog.Any("httpRequestHeaders", redactor.Header(req.Header)),
+			slog.String("httpRequestProto", req.Proto),
+			slog.String("localAddr", localAddr.String()),
+			slog.String("protocol", protocol),
+			slog.String("remoteAddr", remoteAddr.String()),
+			slog.Time("t", t0),
+		)
+	}
+}
+
+// MaybeLogServerRequestDone logs the end of a server request if the
+// given logger is not nil, otherwise it does nothing.
+//
+// We use the same field names used by [MaybeLogRoundTripDone]. The err
+// argument is the request context error, which is not nil when the
+// client went away before the handler completed. The hijacked argument
+// indicates whether the handler took over the connection, in which case
+// the status code is zero unless the handler explicitly wrote it before
+// hijacking, and the body bytes written do not include the bytes the
+// handler wrote to the hijacked connection. The `httpServerHijacked`
+// field contains the hijacked argument.
+func MaybeLogServerRequestDone(
+	logger *slog.Logger,
+	localAddr netip.AddrPort,
+	protocol string,
+	remoteAddr netip.AddrPort,
+	req *http.Request,
+	statusCode int,
+	respHeaders http.Header,
+	bodyBytesWritten int64,
+	hijacked bool,
+	err error,
+	t0 time.Time,
+	t time.Time,
+) {
+	if logger != nil {
+		logger = withCorrelation(logger, req.Context())
+		redactor := redactorFromContext(req.Context())
+		logger.InfoContext(
+			req.Context(),
+			"httpServerRequestDone",
+			slog.Any("err", redactor.Error(err)),
+			slog.Any("errClass", errclass.New(err)),
+			slog.String("httpMethod", req.Method),
+			slog.String("httpUrl", redactor.URL(serverRequestURL(req))),
+			slog.Any("httpRequestHeaders", redactor.Header(req.Header)),
+			slog.String("httpRequestProto", req.Proto),
+			slog.Int("httpResponseStatusCode", statusCode),
+			slog.Any("httpResponseHeaders", redactor.Header(respHeaders)),
+			slog.Int64("httpResponseBodyBytesWritten", bodyBytesWritten),
+			slog.Bool("httpServerHijacked", hijacked),
+			slog.String("localAddr", localAddr.String()),
+			slog.String("protocol", protocol),
+			slog.String("remoteAddr", remoteAddr.String()),
+			slog.Time("t0", t0),
+			slog.Time("t", t),
+			slog.Duration("duration", t.Sub(t0)),
+		)
+	}
+}
+
+// ServerMiddleware is an [http.Handler] middleware that logs each request
+// using [MaybeLogServerRequestStart] and [MaybeLogServerRequestDone].
+//
+// The [http.ResponseWriter] passed to the wrapped handler implements
+// [http.Flusher], [http.Hijacker], and [io.ReaderFrom], which return
+// [http.ErrNotSupported] or fall back to writing when the underlying
+// writer does not support them, so that streaming responses (e.g.,
+// server-sent events) and protocol upgrades (e.g., WebSocket) work.
+type ServerMiddleware struct {
+	// Handler is the MANDATORY wrapped [http.Handler].
+	Handler http.Handler
+
+	// Logger is the OPTIONAL logger to use. If nil, we don't log.
+	Logger *slog.Logger
+
+	// Redactor is the OPTIONAL [*Redactor] to use. If nil, we use the
+	// [*Redactor] in the request context or the default one.
+	Redactor *Redactor
+
+	// TimeNow is the OPTIONAL function to get the current time.
+	// If nil, we use [time.Now].
+	TimeNow func() time.Time
+}
+
+var _ http.Handler = &ServerMiddleware{}
+
+// NewServerMiddleware creates a new [*ServerMiddleware] wrapping the
+// given [http.Handler] and using the given logger.
+func NewServerMiddleware(handler http.Handler, logger *slog.Logger) *ServerMiddleware {
+	return &ServerMiddleware{Handler: handler, Logger: logger, TimeNow: time.Now}
+}
+
+// timeNow returns the current time using TimeNow or [time.Now].
+func (h *ServerMiddleware) timeNow() time.Time {
+	if h.TimeNow != nil {
+		return h.TimeNow()
+	}
+	return time.Now()
+}
+
+// ServeHTTP implements [http.Handler].
+func (h *ServerMiddleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// Possibly override the redactor for this request.
+	if h.Redactor != nil {
+		req = req.WithContext(ContextWithRedactor(req.Context(), h.Redactor))
+	}
+
+	// Determine the connection endpoints.
+	var (
+		localAddr  = netip.AddrPortFrom(netip.IPv6Unspecified(), 0)
+		protocol   string
+		remoteAddr = netipx.ParseAddrPort(req.RemoteAddr)
+	)
+	if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		localAddr = netipx.AddrToAddrPort(addr)
+		protocol = addr.Network()
+	}
+
+	// Log, serve the request, and log again.
+	t0 := h.timeNow()
+	MaybeLogServerRequestStart(h.Logger, localAddr, protocol, remoteAddr, req, t0)
+	rw := &responseWriter{ResponseWriter: w}
+	h.Handler.ServeHTTP(rw, req)
+	err := req.Context().Err()
+	MaybeLogServerRequestDone(h.Logger, localAddr, protocol, remoteAddr, req,
+		rw.statusCode(), w.Header(), rw.count, rw.hijacked, err, t0, h.timeNow())
+}
+
+// responseWriter wraps an [http.ResponseWriter] to record the status code
+// and the number of body bytes written. We forward the optional interfaces
+// to the underlying writer and implement Unwrap such that
+// [http.ResponseController] can access the underlying writer features.
+type responseWriter struct {
+	http.ResponseWriter
+	count    int64
+	hijacked bool
+	status   int
+}
+
+// WriteHeader implements [http.ResponseWriter].
+func (rw *responseWriter) WriteHeader(statusCode int) {
+	// informational responses other than protocol switches are not final
+	final := statusCode >= 200 || statusCode == http.StatusSwitchingProtocols
+	if rw.status == 0 && final {
+		rw.status = statusCode
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements [http.ResponseWriter].
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	count, err := rw.ResponseWriter.Write(data)
+	rw.count += int64(count)
+	return count, err
+}
+
+// Unwrap returns the wrapped [http.ResponseWriter].
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Flush implements [http.Flusher]. Flushing is a no-op when the
+// underlying [http.ResponseWriter] does not support it.
+func (rw *responseWriter) Flush() {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack implements [http.Hijacker]. We return [http.ErrNotSupported] when
+// the underlying [http.ResponseWriter] does not support hijacking.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, bufrw, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil {
+		rw.hijacked = true
+	}
+	return conn, bufrw, err
+}
+
+// ReadFrom implements [io.ReaderFrom].
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	count, err := io.Copy(rw.ResponseWriter, src)
+	rw.count += count
+	return count, err
+}
+
+// statusCode returns the status code sent to the client, which is zero
+// when the handler hijacked the connection without writing the status.
+func (rw *responseWriter) statusCode() int {
+	if rw.status == 0 && !rw.hijacked {
+		return http.StatusOK
+	}
+	return rw.status
+}
@@ -0,0 +1,251 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package httpslog
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaybeLogServerRequestDone(t *testing.T) {
+	tests := []struct {
+		name      string
+		newLogger func(w io.Writer) *slog.Logger
+		expectLog string
+	}{
+		{
+			name:      "Logger set",
+			newLogger: newTestLogger,
+			expectLog: `{"level":"INFO","msg":"httpServerRequestDone","err":null,"errClass":"",` +
+				`"httpMethod":"GET","httpUrl":"http://example.com/path","httpRequestHeaders":{},` +
+				`"httpRequestProto":"HTTP/1.1","httpResponseStatusCode":404,` +
+				`"httpResponseHeaders":{"Content-Type":["text/plain"]},"httpResponseBodyBytesWritten":9,` +
+				`"httpServerHijacked":false,"localAddr":"127.0.0.1:80","protocol":"tcp","remoteAddr":"127.0.0.1:54321",` +
+				`"t0":"2020-01-01T00:00:00Z","t":"2020-01-01T00:00:01Z","duration":1000000000}` + "\n",
+		},
+
+		{
+			name:      "Logger not set",
+			newLogger: func(w io.Writer) *slog.Logger { return nil },
+			expectLog: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			req := httptest.NewRequest("GET", "/path", nil)
+			t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			MaybeLogServerRequestDone(
+				tt.newLogger(&out),
+				netip.MustParseAddrPort("127.0.0.1:80"),
+				"tcp",
+				netip.MustParseAddrPort("127.0.0.1:54321"),
+				req,
+				404,
+				http.Header{"Content-Type": {"text/plain"}},
+				9,
+				false,
+				nil,
+				t0,
+				t0.Add(time.Second),
+			)
+			assert.Equal(t, tt.expectLog, out.String())
+		})
+	}
+}
+
+func TestServerMiddleware(t *testing.T) {
+	t.Run("correlates with client events", func(t *testing.T) {
+		var serverOut bytes.Buffer
+		handler := NewServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("I'm a teapot"))
+			http.NewResponseController(w).Flush()
+		}), slog.New(slog.NewJSONHandler(&serverOut, nil)))
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+
+		var clientOut bytes.Buffer
+		client := &http.Client{
+			Transport: NewRoundTripper(http.DefaultTransport, slog.New(slog.NewJSONHandler(&clientOut, nil))),
+		}
+		req, err := http.NewRequest("GET", srv.URL+"/teapot?x=1", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		serverEvents := parseJSONLines(t, &serverOut)
+		require.Len(t, serverEvents, 2)
+		clientEvents := parseJSONLines(t, &clientOut)
+		require.Len(t, clientEvents, 2)
+
+		start, done := serverEvents[0], serverEvents[1]
+		assert.Equal(t, "httpServerRequestStart", start["msg"])
+		assert.Equal(t, "httpServerRequestDone", done["msg"])
+
+		// the server and client views should mirror each other
+		clientDone := clientEvents[1]
+		assert.Equal(t, clientDone["httpUrl"], done["httpUrl"])
+		assert.Equal(t, clientDone["httpMethod"], done["httpMethod"])
+		assert.Equal(t, clientDone["localAddr"], done["remoteAddr"])
+		assert.Equal(t, clientDone["remoteAddr"], done["localAddr"])
+		assert.Equal(t, clientDone["protocol"], done["protocol"])
+		assert.Equal(t, clientDone["httpResponseStatusCode"], done["httpResponseStatusCode"])
+
+		assert.Equal(t, float64(http.StatusTeapot), done["httpResponseStatusCode"])
+		assert.Equal(t, float64(len("I'm a teapot")), done["httpResponseBodyBytesWritten"])
+		assert.Equal(t, "HTTP/1.1", done["httpRequestProto"])
+		assert.Equal(t, "", done["errClass"])
+		headers := start["httpRequestHeaders"].(map[string]any)
+		assert.Equal(t, []any{RedactedValue}, headers["Authorization"])
+	})
+
+	t.Run("implicit status code", func(t *testing.T) {
+		var out bytes.Buffer
+		handler := &ServerMiddleware{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusContinue)
+			}),
+			Logger:   slog.New(slog.NewJSONHandler(&out, nil)),
+			Redactor: &Redactor{},
+		}
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		events := parseJSONLines(t, &out)
+		require.Len(t, events, 2)
+		assert.Equal(t, float64(http.StatusOK), events[1]["httpResponseStatusCode"])
+		assert.Equal(t, "192.0.2.1:1234", events[1]["remoteAddr"])
+		assert.Equal(t, "[::]:0", events[1]["localAddr"])
+		headers := events[1]["httpRequestHeaders"].(map[string]any)
+		assert.Equal(t, []any{"Bearer secret"}, headers["Authorization"])
+	})
+
+	t.Run("streams using http.Flusher", func(t *testing.T) {
+		var out bytes.Buffer
+		proceed := make(chan struct{})
+		handler := NewServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				http.Error(w, "streaming not supported", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: first\n\n"))
+			flusher.Flush()
+			<-proceed
+			w.Write([]byte("data: second\n\n"))
+		}), slog.New(slog.NewJSONHandler(&out, nil)))
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// we can only read the first event if the server flushed it
+		reader := bufio.NewReader(resp.Body)
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "data: first\n", line)
+		close(proceed)
+		rest, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "\ndata: second\n\n", string(rest))
+	})
+
+	t.Run("upgrades using http.Hijacker", func(t *testing.T) {
+		var out bytes.Buffer
+		handler := NewServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hijacker, ok := w.(http.Hijacker)
+			if !ok {
+				http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+				return
+			}
+			conn, bufrw, err := hijacker.Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			bufrw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+			bufrw.Flush()
+			io.Copy(conn, bufrw)
+		}), slog.New(slog.NewJSONHandler(&out, nil)))
+		done := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTP(w, r)
+			close(done)
+		}))
+		defer srv.Close()
+
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(time.Second))
+		_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+		require.NoError(t, err)
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(reader, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+		conn.Close()
+		<-done
+
+		events := parseJSONLines(t, &out)
+		require.Len(t, events, 2)
+		assert.Equal(t, "httpServerRequestDone", events[1]["msg"])
+		assert.Equal(t, true, events[1]["httpServerHijacked"])
+		assert.Equal(t, float64(0), events[1]["httpResponseStatusCode"])
+		assert.Equal(t, float64(0), events[1]["httpResponseBodyBytesWritten"])
+	})
+
+	t.Run("hijacking is not supported by the underlying writer", func(t *testing.T) {
+		var hijackErr error
+		handler := NewServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _, hijackErr = w.(http.Hijacker).Hijack()
+		}), nil)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		assert.ErrorIs(t, hijackErr, http.ErrNotSupported)
+	})
+
+	t.Run("counts the bytes written using io.ReaderFrom", func(t *testing.T) {
+		var out bytes.Buffer
+		handler := NewServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.(io.ReaderFrom).ReadFrom(strings.NewReader("Bonsoir, Elliot!"))
+		}), slog.New(slog.NewJSONHandler(&out, nil)))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, "Bonsoir, Elliot!", rr.Body.String())
+
+		events := parseJSONLines(t, &out)
+		require.Len(t, events, 2)
+		assert.Equal(t, float64(http.StatusOK), events[1]["httpResponseStatusCode"])
+		assert.Equal(t, float64(len("Bonsoir, Elliot!")), events[1]["httpResponseBodyBytesWritten"])
+	})
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package mitmtest
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/rbmk-project/common/selfsignedcert"
+)
+
+// The actions the [*Proxy] can take for each connection.
+const (
+	// ActionForward forwards the connection to the upstream server.
+	ActionForward = "forward"
+
+	// ActionReset resets the connection after reading the first request.
+	ActionReset = "reset"
+
+	// ActionDrop forwards the first DropAfter bytes in each direction
+	// and then silently drops any further byte.
+	ActionDrop = "drop"
+
+	// ActionBlockpage terminates TLS using a certificate for the server
+	// name signed by the CA, if needed, and serves the blockpage.
+	ActionBlockpage = "blockpage"
+
+	// ActionMismatchCert terminates TLS using a certificate signed by
+	// the CA for MismatchName rather than for the server name.
+	ActionMismatchCert = "mismatchCert"
+
+	// ActionUnknownCA terminates TLS using a self-signed certificate
+	// for the server name, which the CA did not sign.
+	ActionUnknownCA = "unknownCA"
+)
+
+// DefaultBlockpage is the default blockpage served by [ActionBlockpage].
+const DefaultBlockpage = "<html><body><h1>This website has been blocked</h1></body></html>\n"
+
+// DefaultMismatchName is the default server name used by [ActionMismatchCert].
+const DefaultMismatchName = "mismatch.invalid"
+
+// Config contains configuration for [NewProxy].
+type Config struct {
+	// Actions maps the server name (i.e., the TLS SNI or the HTTP host) to
+	// the action to take. We match the names ignoring the case, therefore
+	// names differing only by case should map to the same action.
+	Actions map[string]string
+
+	// Blockpage is the OPTIONAL body served by [ActionBlockpage]. If
+	// empty, we use [DefaultBlockpage].
+	Blockpage []byte
+
+	// CA is the MANDATORY [*selfsignedcert.CA] we use to mint certificates.
+	CA *selfsignedcert.CA
+
+	// DefaultAction is the OPTIONAL action to take for server names not
+	// in Actions. If empty, we use [ActionForward].
+	DefaultAction string
+
+	// DropAfter is the number of bytes forwarded by [ActionDrop].
+	DropAfter int
+
+	// Logger is the OPTIONAL logger to use. If nil, we don't log.
+	Logger *slog.Logger
+
+	// MismatchName is the OPTIONAL server name used by [ActionMismatchCert].
+	// If empty, we use [DefaultMismatchName].
+	MismatchName string
+
+	// TimeNow is the OPTIONAL function to get the current time.
+	// If nil, we use [time.Now].
+	TimeNow func() time.Time
+
+	// Upstream is the address of the upstream server used by [ActionForward]
+	// and [ActionDrop]. If empty, these actions close the connection.
+	Upstream string
+}
+
+// NewConfig creates a new [*Config] using the given CA and upstream server address.
+func NewConfig(ca *selfsignedcert.CA, upstream string) *Config {
+	return &Config{
+		Actions:  map[string]string{},
+		CA:       ca,
+		TimeNow:  time.Now,
+		Upstream: upstream,
+	}
+}
+
+// actions returns a copy of Actions using lowercase server names.
+func (c *Config) actions() map[string]string {
+	actions := make(map[string]string, len(c.Actions))
+	for serverName, action := range c.Actions {
+		actions[strings.ToLower(serverName)] = action
+	}
+	return actions
+}
+
+// defaultAction returns DefaultAction or [ActionForward].
+func (c *Config) defaultAction() string {
+	if c.DefaultAction != "" {
+		return c.DefaultAction
+	}
+	return ActionForward
+}
+
+// blockpage returns Blockpage or [DefaultBlockpage].
+func (c *Config) blockpage() []byte {
+	if len(c.Blockpage) > 0 {
+		return c.Blockpage
+	}
+	return []byte(DefaultBlockpage)
+}
+
+// mismatchName returns MismatchName or [DefaultMismatchName].
+func (c *Config) mismatchName() string {
+	if c.MismatchName != "" {
+		return c.MismatchName
+	}
+	return DefaultMismatchName
+}
+
+// timeNow returns the current time using TimeNow or [time.Now].
+func (c *Config) timeNow() time.Time {
+	if c.TimeNow != nil {
+		return c.TimeNow()
+	}
+	return time.Now()
+}
@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package mitmtest
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newUnreachableAddr returns the address of a listener that never accepts
+// and whose queue is full, so that dialing it blocks until the timeout.
+func newUnreachableAddr(t *testing.T) string {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { syscall.Close(fd) })
+	require.NoError(t, syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}))
+	require.NoError(t, syscall.Listen(fd, 0))
+	sockaddr, err := syscall.Getsockname(fd)
+	require.NoError(t, err)
+	address := fmt.Sprintf("127.0.0.1:%d", sockaddr.(*syscall.SockaddrInet4).Port)
+
+	// Fill the queue, which holds a single connection with a zero backlog.
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return address
+}
+
+func TestProxyCloseWithUnreachableUpstream(t *testing.T) {
+	env := newTestEnv(t, func(config *Config) {
+		config.Upstream = newUnreachableAddr(t)
+	})
+	go env.get("https://www.example.com/", 10*time.Second)
+
+	// Wait for the proxy to start dialing the upstream server.
+	require.Eventually(t, func() bool {
+		return len(env.out.events(t)) >= 2
+	}, time.Second, 10*time.Millisecond)
+
+	t0 := time.Now()
+	require.NoError(t, env.proxy.Close())
+	assert.Less(t, time.Since(t0), time.Second)
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package mitmtest
+
+import (
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/rbmk-project/common/errclass"
+	"github.com/rbmk-project/common/netipx"
+)
+
+func (p *Proxy) logConnStart(conn net.Conn, t0 time.Time) {
+	if p.config.Logger != nil {
+		p.config.Logger.Info(
+			"proxyConnStart",
+			slog.String("localAddr", netipx.AddrToAddrPort(conn.LocalAddr()).String()),
+			slog.String("protocol", "tcp"),
+			slog.String("remoteAddr", netipx.AddrToAddrPort(conn.RemoteAddr()).String()),
+			slog.Time("t", t0),
+		)
+	}
+}
+
+func (p *Proxy) logAction(action, serverName string, isTLS bool) {
+	if p.config.Logger != nil {
+		p.config.Logger.Info(
+			"proxyAction",
+			slog.String("proxyAction", action),
+			slog.String("proxyServerName", serverName),
+			slog.Bool("proxyTLS", isTLS),
+			slog.Time("t", p.config.timeNow()),
+		)
+	}
+}
+
+func (p *Proxy) logConnDone(conn net.Conn, action, serverName string, err error, t0 time.Time) {
+	if p.config.Logger != nil {
+		t := p.config.timeNow()
+		p.config.Logger.Info(
+			"proxyConnDone",
+			slog.Any("err", err),
+			slog.Any("errClass", errclass.New(err)),
+			slog.String("localAddr", netipx.AddrToAddrPort(conn.LocalAddr()).String()),
+			slog.String("protocol", "tcp"),
+			slog.String("proxyAction", action),
+			slog.String("proxyServerName", serverName),
+			slog.String("remoteAddr", netipx.AddrToAddrPort(conn.RemoteAddr()).String()),
+			slog.Time("t0", t0),
+			slog.Time("t", t),
+			slog.Duration("duration", t.Sub(t0)),
+		)
+	}
+}
@@ -0,0 +1,407 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package mitmtest implements an in-process transparent MITM proxy for testing
+// TLS and HTTP measurement code against hostile middleboxes.
+//
+// Use [NewProxy] with a [*Config] mapping server names to actions. For each
+// connection, we read the first request to learn the server name, which is
+// the SNI for TLS and the Host header for HTTP, and we take the configured
+// action (e.g., [ActionReset] or [ActionBlockpage]). We mint certificates on
+// the fly using a [*selfsignedcert.CA], so clients trusting the CA can
+// successfully connect when we terminate TLS.
+//
+// The proxy is transparent: clients connect to it as if it were the server,
+// e.g., by using the Dial method of [*Proxy] as the dialer or by resolving
+// names to the proxy address using [github.com/rbmk-project/common/dnstest].
+//
+// # Logging
+//
+// When a logger is configured, we emit the `proxyConnStart` event when
+// accepting a connection, the `proxyAction` event after reading the first
+// request, and the `proxyConnDone` event when done. The start and done events
+// include the `localAddr` and `remoteAddr` of the client connection. The
+// action and done events include the `proxyAction` and `proxyServerName`.
+// The done event also includes the error (`err` and `errClass`, see
+// [errclass.New]) and the connection lifetime (`t0`, `t`, and `duration`).
+package mitmtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rbmk-project/common/runtimex"
+	"github.com/rbmk-project/common/selfsignedcert"
+)
+
+// Proxy is an in-process transparent MITM proxy.
+//
+// Construct using [NewProxy].
+type Proxy struct {
+	// Addr is the address of the proxy listener.
+	Addr string
+
+	// actions maps lowercase server names to actions.
+	actions map[string]string
+
+	// cancel cancels ctx.
+	cancel context.CancelFunc
+
+	// closed indicates whether we have been closed.
+	closed bool
+
+	// config is the proxy configuration.
+	config *Config
+
+	// conns contains the active connections.
+	conns map[net.Conn]struct{}
+
+	// ctx is the context used to dial the upstream server, which
+	// we cancel when closing to interrupt pending dials.
+	ctx context.Context
+
+	// listener is the TCP listener.
+	listener net.Listener
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// wg allows to wait for the background goroutines.
+	wg sync.WaitGroup
+}
+
+// NewProxy creates and starts a new [*Proxy] using the given [*Config],
+// which we do not copy, so don't modify it while the proxy is running.
+//
+// This function panics on failure.
+func NewProxy(config *Config) *Proxy {
+	runtimex.Assert(config.CA != nil, "mitmtest: the CA is MANDATORY")
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Proxy{
+		actions:  config.actions(),
+		cancel:   cancel,
+		config:   config,
+		conns:    map[net.Conn]struct{}{},
+		ctx:      ctx,
+		listener: runtimex.Try1(net.Listen("tcp", "127.0.0.1:0")),
+	}
+	p.Addr = p.listener.Addr().String()
+	p.wg.Add(1)
+	go p.serve()
+	return p
+}
+
+// Close stops the proxy, interrupts the pending dials, closes the active
+// connections, and waits for the background goroutines to terminate.
+func (p *Proxy) Close() error {
+	p.listener.Close()
+	p.cancel()
+	p.mu.Lock()
+	p.closed = true
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return nil
+}
+
+// Dial dials a connection with the proxy ignoring the given address, which
+// makes this method suitable as the DialContext field of [*http.Transport].
+func (p *Proxy) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	return (&net.Dialer{}).DialContext(ctx, "tcp", p.Addr)
+}
+
+// track adds the connection to the active connections or removes it. When
+// adding a connection after Close, we immediately close it.
+func (p *Proxy) track(conn net.Conn, add bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case add && p.closed:
+		conn.Close()
+	case add:
+		p.conns[conn] = struct{}{}
+	default:
+		delete(p.conns, conn)
+	}
+}
+
+// serve accepts and serves connections.
+func (p *Proxy) serve() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.track(conn, true)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer p.track(conn, false)
+			defer conn.Close()
+			p.serveConn(conn)
+		}()
+	}
+}
+
+// serveConn serves a single connection.
+func (p *Proxy) serveConn(conn net.Conn) {
+	t0 := p.config.timeNow()
+	p.logConnStart(conn, t0)
+
+	// Read the first request to learn the server name.
+	sc := &sniffConn{Conn: conn}
+	serverName, isTLS, err := sniff(sc)
+	if err != nil {
+		p.logConnDone(conn, "", "", err, t0)
+		return
+	}
+	action := p.action(serverName)
+	p.logAction(action, serverName, isTLS)
+
+	// Make sure the action sees the bytes we have already read.
+	replay := &replayConn{Conn: conn, prefix: bytes.NewReader(sc.buf.Bytes())}
+
+	switch action {
+	case ActionReset:
+		err = reset(conn)
+	case ActionDrop:
+		err = p.forward(replay, p.config.DropAfter)
+	case ActionBlockpage:
+		err = p.blockpage(replay, serverName, isTLS)
+	case ActionMismatchCert:
+		err = handshake(replay, p.config.CA.TLSCertificate(p.config.mismatchName()))
+	case ActionUnknownCA:
+		err = handshake(replay, newSelfSignedCert(serverName))
+	case ActionForward:
+		err = p.forward(replay, -1)
+	default:
+		err = ErrUnknownAction
+	}
+	p.logConnDone(conn, action, serverName, err, t0)
+}
+
+// action returns the action for the given server name.
+func (p *Proxy) action(serverName string) string {
+	if action, found := p.actions[strings.ToLower(serverName)]; found {
+		return action
+	}
+	return p.config.defaultAction()
+}
+
+// ErrUnknownAction indicates that the configured action is unknown.
+var ErrUnknownAction = errors.New("mitmtest: unknown action")
+
+// errSniffDone is the error we use to interrupt the TLS handshake
+// after we have read the ClientHello.
+var errSniffDone = errors.New("mitmtest: sniff done")
+
+// sniffConn is a [net.Conn] recording the bytes read and refusing to write.
+type sniffConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+// Read implements [net.Conn].
+func (c *sniffConn) Read(data []byte) (int, error) {
+	count, err := c.Conn.Read(data)
+	c.buf.Write(data[:count])
+	return count, err
+}
+
+// Write implements [net.Conn].
+func (c *sniffConn) Write(data []byte) (int, error) {
+	return 0, errSniffDone
+}
+
+// readerConn is a [net.Conn] reading from a [*bufio.Reader].
+type readerConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read implements [net.Conn].
+func (c *readerConn) Read(data []byte) (int, error) {
+	return c.reader.Read(data)
+}
+
+// sniff reads the TLS ClientHello or the HTTP request and returns the
+// server name and whether the connection uses TLS.
+func sniff(sc *sniffConn) (string, bool, error) {
+	reader := bufio.NewReader(sc)
+	first, err := reader.Peek(1)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Handle the case of plaintext HTTP.
+	if first[0] != 0x16 {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return "", false, err
+		}
+		host, _, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			host = req.Host
+		}
+		return host, false, nil
+	}
+
+	// Handle the case of TLS by interrupting the handshake after the ClientHello.
+	var (
+		sawHello   bool
+		serverName string
+	)
+	config := &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			sawHello, serverName = true, hello.ServerName
+			return nil, errSniffDone
+		},
+	}
+	err = tls.Server(&readerConn{Conn: sc, reader: reader}, config).Handshake()
+	if !sawHello {
+		return "", true, err
+	}
+	return serverName, true, nil
+}
+
+// replayConn is a [net.Conn] that reads the prefix before reading from the conn.
+type replayConn struct {
+	net.Conn
+	prefix *bytes.Reader
+}
+
+// Read implements [net.Conn].
+func (c *replayConn) Read(data []byte) (int, error) {
+	if c.prefix.Len() > 0 {
+		return c.prefix.Read(data)
+	}
+	return c.Conn.Read(data)
+}
+
+// reset resets the connection.
+func reset(conn net.Conn) error {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+	return conn.Close()
+}
+
+// forward forwards the connection to the upstream server. When limit is
+// not negative, we silently drop the bytes exceeding limit in each direction.
+func (p *Proxy) forward(conn net.Conn, limit int) error {
+	if p.config.Upstream == "" {
+		return nil
+	}
+	upstream, err := (&net.Dialer{}).DialContext(p.ctx, "tcp", p.config.Upstream)
+	if err != nil {
+		return err
+	}
+	p.track(upstream, true)
+	defer p.track(upstream, false)
+	defer upstream.Close()
+
+	errch := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(&dropWriter{Writer: upstream, limit: limit}, conn)
+		errch <- err
+	}()
+	go func() {
+		_, err := io.Copy(&dropWriter{Writer: conn, limit: limit}, upstream)
+		errch <- err
+	}()
+
+	// When either direction terminates, we close both connections to
+	// make sure the other direction terminates as well.
+	err = <-errch
+	conn.Close()
+	upstream.Close()
+	<-errch
+	return err
+}
+
+// dropWriter is an [io.Writer] silently dropping the bytes exceeding limit,
+// unless the limit is negative, in which case we write all the bytes.
+type dropWriter struct {
+	io.Writer
+	limit int
+}
+
+// Write implements [io.Writer].
+func (w *dropWriter) Write(data []byte) (int, error) {
+	if w.limit < 0 {
+		return w.Writer.Write(data)
+	}
+	count := min(len(data), w.limit)
+	if count > 0 {
+		if _, err := w.Writer.Write(data[:count]); err != nil {
+			return 0, err
+		}
+		w.limit -= count
+	}
+	return len(data), nil
+}
+
+// blockpage serves the blockpage, terminating TLS if needed.
+func (p *Proxy) blockpage(conn net.Conn, serverName string, isTLS bool) error {
+	if isTLS {
+		if serverName == "" {
+			serverName, _, _ = net.SplitHostPort(conn.LocalAddr().String())
+		}
+		tlsConn := tls.Server(conn, &tls.Config{
+			Certificates: []tls.Certificate{*p.config.CA.TLSCertificate(serverName)},
+			NextProtos:   []string{"http/1.1"},
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		conn = tlsConn
+	}
+	if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+		return err
+	}
+	body := p.config.blockpage()
+	resp := &http.Response{
+		StatusCode:    http.StatusUnavailableForLegalReasons,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/html"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Close:         true,
+	}
+	return resp.Write(conn)
+}
+
+// handshake performs the TLS handshake using the given certificate, which
+// we expect to fail because the client does not trust the certificate.
+func handshake(conn net.Conn, cert *tls.Certificate) error {
+	tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{*cert}})
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	// Wait for the client to close the connection.
+	_, err := io.Copy(io.Discard, tlsConn)
+	return err
+}
+
+// newSelfSignedCert creates a self-signed [*tls.Certificate] for the given server name.
+//
+// This function panics on failure.
+func newSelfSignedCert(serverName string) *tls.Certificate {
+	cert := selfsignedcert.New(&selfsignedcert.Config{
+		CommonName: serverName,
+		DNSNames:   []string{serverName},
+	})
+	tlsCert := runtimex.Try1(tls.X509KeyPair(cert.CertPEM, cert.KeyPEM))
+	return &tlsCert
+}
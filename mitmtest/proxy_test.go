@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package mitmtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rbmk-project/common/errclass"
+	"github.com/rbmk-project/common/selfsignedcert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lockedBuffer is a [bytes.Buffer] safe for concurrent use.
+type lockedBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+// Write implements [io.Writer].
+func (b *lockedBuffer) Write(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(data)
+}
+
+// events parses the JSON log lines written so far.
+func (b *lockedBuffer) events(t *testing.T) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var events []map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(b.buf.Bytes()))
+	for decoder.More() {
+		var event map[string]any
+		require.NoError(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+	return events
+}
+
+// testEnv is the environment used by the tests.
+type testEnv struct {
+	client *http.Client
+	out    *lockedBuffer
+	proxy  *Proxy
+}
+
+// newTestEnv creates a [*testEnv] with a proxy in front of an upstream HTTPS
+// server using a certificate signed by the CA for www.example.com.
+func newTestEnv(t *testing.T, configure func(config *Config)) *testEnv {
+	ca := selfsignedcert.NewCA("RBMK Test CA")
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Bonsoir, Elliot!\n"))
+	}))
+	upstream.TLS = &tls.Config{Certificates: []tls.Certificate{*ca.TLSCertificate("www.example.com")}}
+	upstream.Config.ErrorLog = log.New(io.Discard, "", 0) // the drop tests cause errors
+	upstream.StartTLS()
+	t.Cleanup(upstream.Close)
+
+	out := &lockedBuffer{}
+	config := NewConfig(ca, upstream.Listener.Addr().String())
+	config.Logger = slog.New(slog.NewJSONHandler(out, nil))
+	configure(config)
+	proxy := NewProxy(config)
+	t.Cleanup(func() { proxy.Close() })
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext:       proxy.Dial,
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{RootCAs: ca.CertPool()},
+	}}
+	return &testEnv{client: client, out: out, proxy: proxy}
+}
+
+// get performs a GET request with the given timeout.
+func (env *testEnv) get(URL string, timeout time.Duration) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := env.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+func TestProxy(t *testing.T) {
+	t.Run("forward", func(t *testing.T) {
+		env := newTestEnv(t, func(config *Config) {})
+		resp, body, err := env.get("https://www.example.com/", time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Bonsoir, Elliot!\n", string(body))
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		env := newTestEnv(t, func(config *Config) {
+			config.Actions["WWW.example.com"] = ActionReset
+		})
+		_, _, err := env.get("https://www.example.com/", time.Second)
+		assert.Equal(t, errclass.ECONNRESET, errclass.New(err))
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		env := newTestEnv(t, func(config *Config) {
+			config.DefaultAction = ActionDrop
+			config.DropAfter = 0
+		})
+		_, _, err := env.get("https://www.example.com/", 100*time.Millisecond)
+		assert.Equal(t, errclass.ETIMEDOUT, errclass.New(err))
+	})
+
+	t.Run("drop in the middle of the ClientHello", func(t *testing.T) {
+		env := newTestEnv(t, func(config *Config) {
+			config.DefaultAction = ActionDrop
+			config.DropAfter = 10
+		})
+		_, _, err := env.get("https://www.example.com/", 250*time.Millisecond)
+		assert.Equal(t, errclass.ETIMEDOUT, errclass.New(err))
+	})
+
+	t.Run("blockpage over TLS", func(t *testing.T) {
+		env := newTestEnv(t, func(config *Config) {
+			config.Actions["www.example.com"] = ActionBlockpage
+		})
+		resp, body, err := env.get("https://www.example.com/", time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnavailableForLegalReasons, resp.StatusCode)
+		assert.Equal(t, DefaultBlockpage, string(body))
+	})
+
+	t.Run("blockpage over HTTP", func(t *testing.T) {
+		env := newTestEnv(t, func(config *Config) {
+			config.Actions["www.example.com"] = ActionBlockpage
+			config.Blockpage = []byte("blocked\n")
+		})
+		resp, body, err := env.get("http://www.example.com:80/", time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnavailableForLegalReasons, resp.StatusCode)
+		assert.Equal(t, "blocked\n", string(body))
+	})
+
+	t.Run("mismatch cert", func(t *testing.T) {
+		env := newTestEnv(t, func(config *Config) {
+			config.Actions["www.example.com"] = ActionMismatchCert
+		})
+		_, _, err := env.get("https://www.example.com/", time.Second)
+		assert.Equal(t, errclass.ETLS_HOSTNAME_MISMATCH, errclass.New(err))
+	})
+
+	t.Run("unknown CA", func(t *testing.T) {
+		env := newTestEnv(t, func(config *Config) {
+			config.Actions["www.example.com"] = ActionUnknownCA
+		})
+		_, _, err := env.get("https://www.example.com/", time.Second)
+		assert.Equal(t, errclass.ETLS_CA_UNKNOWN, errclass.New(err))
+	})
+
+	t.Run("unknown action", func(t *testing.T) {
+		env := newTestEnv(t, func(config *Config) {
+			config.DefaultAction = "nonexistent"
+		})
+		_, _, err := env.get("https://www.example.com/", time.Second)
+		assert.Error(t, err)
+	})
+
+	t.Run("forward without upstream", func(t *testing.T) {
+		env := newTestEnv(t, func(config *Config) {
+			config.Upstream = ""
+		})
+		_, _, err := env.get("https://www.example.com/", time.Second)
+		assert.Equal(t, errclass.EEOF, errclass.New(err))
+	})
+}
+
+func TestProxyEvents(t *testing.T) {
+	env := newTestEnv(t, func(config *Config) {
+		config.Actions["www.example.com"] = ActionMismatchCert
+	})
+	_, _, err := env.get("https://www.example.com/", time.Second)
+	require.Error(t, err)
+	require.NoError(t, env.proxy.Close())
+
+	var names []string
+	events := env.out.events(t)
+	for _, event := range events {
+		names = append(names, event["msg"].(string))
+	}
+	require.Equal(t, []string{"proxyConnStart", "proxyAction", "proxyConnDone"}, names)
+	assert.Equal(t, ActionMismatchCert, events[1]["proxyAction"])
+	assert.Equal(t, "www.example.com", events[1]["proxyServerName"])
+	assert.Equal(t, true, events[1]["proxyTLS"])
+	assert.Equal(t, ActionMismatchCert, events[2]["proxyAction"])
+	assert.NotEmpty(t, events[2]["err"])
+	assert.Equal(t, events[0]["remoteAddr"], events[2]["remoteAddr"])
+}
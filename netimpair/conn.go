@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package netimpair
+
+import (
+	"net"
+	"os"
+	"time"
+
+	"github.com/rbmk-project/common/netipx"
+)
+
+// WrapConn wraps a [net.Conn] to apply the impairments in the given [*Config].
+//
+// When resetting the connection after ResetAfter bytes, we close the underlying
+// connection, which we configure to send a RST segment if it is a [*net.TCPConn],
+// and we return an error that [errclass.New] classifies as ECONNRESET from the
+// current and all the subsequent reads and writes.
+//
+// Like the standard library connections, we wrap the errors caused by deadlines
+// and by closing the connection while impairing it in a [*net.OpError].
+func WrapConn(conn net.Conn, config *Config) net.Conn {
+	return newConn(conn, netipx.AddrNetwork(conn.LocalAddr(), ""), newImpairer(config, 0))
+}
+
+// newConn creates a new [*connWrapper] using the given network.
+func newConn(conn net.Conn, network string, im *impairer) *connWrapper {
+	return &connWrapper{Conn: conn, im: im, network: network}
+}
+
+// connWrapper implements [WrapConn].
+type connWrapper struct {
+	// Conn is the underlying [net.Conn].
+	net.Conn
+
+	// count is the number of bytes read and written so far.
+	count int64
+
+	// im is the [*impairer] to use.
+	im *impairer
+
+	// network is the connection network.
+	network string
+
+	// reset indicates whether we have reset the connection.
+	reset bool
+}
+
+// allowance returns the number of bytes we can transfer before resetting,
+// given a buffer of the given size, and whether we should reset now.
+func (c *connWrapper) allowance(size int) (int, bool) {
+	c.im.mu.Lock()
+	defer c.im.mu.Unlock()
+	if c.reset {
+		return 0, true
+	}
+	if c.im.config.ResetAfter <= 0 {
+		return size, false
+	}
+	remaining := c.im.config.ResetAfter - c.count
+	if remaining <= 0 {
+		return 0, true
+	}
+	return int(min(int64(size), remaining)), false
+}
+
+// account accounts for the transferred bytes.
+func (c *connWrapper) account(count int) {
+	c.im.mu.Lock()
+	c.count += int64(count)
+	c.im.mu.Unlock()
+}
+
+// resetConn resets the connection and returns the corresponding error.
+func (c *connWrapper) resetConn(op string) error {
+	c.im.mu.Lock()
+	c.reset = true
+	c.im.mu.Unlock()
+	if lingerer, ok := c.Conn.(interface{ SetLinger(sec int) error }); ok {
+		lingerer.SetLinger(0)
+	}
+	c.Conn.Close()
+	return c.opError(op, os.NewSyscallError(op, errECONNRESET))
+}
+
+// opError wraps the given error for the given operation in a [*net.OpError].
+func (c *connWrapper) opError(op string, err error) error {
+	return newOpError(op, c.network, c.Conn.LocalAddr(), c.Conn.RemoteAddr(), err)
+}
+
+// Read implements [net.Conn].
+func (c *connWrapper) Read(buf []byte) (int, error) {
+	allowed, reset := c.allowance(len(buf))
+	if reset {
+		return 0, c.resetConn("read")
+	}
+	readDeadline, _ := c.im.deadlines()
+	if err := c.im.sleep(c.im.latency(), readDeadline); err != nil {
+		return 0, c.opError("read", err)
+	}
+	count, err := c.Conn.Read(buf[:allowed])
+	c.account(count)
+	c.im.sleep(c.im.transmission(count), time.Time{}) // we already have the data
+	return count, err
+}
+
+// Write implements [net.Conn].
+func (c *connWrapper) Write(data []byte) (int, error) {
+	allowed, reset := c.allowance(len(data))
+	if reset {
+		return 0, c.resetConn("write")
+	}
+	_, writeDeadline := c.im.deadlines()
+	if err := c.im.sleep(c.im.latency()+c.im.transmission(allowed), writeDeadline); err != nil {
+		return 0, c.opError("write", err)
+	}
+	count, err := c.Conn.Write(data[:allowed])
+	c.account(count)
+	if err == nil && count < len(data) {
+		err = c.resetConn("write")
+	}
+	return count, err
+}
+
+// Close implements [net.Conn].
+func (c *connWrapper) Close() error {
+	c.im.close()
+	return c.Conn.Close()
+}
+
+// SetDeadline implements [net.Conn].
+func (c *connWrapper) SetDeadline(t time.Time) error {
+	c.im.setDeadline(t)
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline implements [net.Conn].
+func (c *connWrapper) SetReadDeadline(t time.Time) error {
+	c.im.setReadDeadline(t)
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements [net.Conn].
+func (c *connWrapper) SetWriteDeadline(t time.Time) error {
+	c.im.setWriteDeadline(t)
+	return c.Conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package netimpair implements [net.Conn] and [net.PacketConn] wrappers
+// impairing the network, which allows to test timeout and retry behavior
+// using real loopback connections without external tools like netem.
+//
+// Use [WrapConn] to add latency, jitter, bandwidth limits, and mid-stream
+// resets to a [net.Conn]. Use [WrapPacketConn] to add latency, jitter,
+// bandwidth limits, and packet loss, duplication, and reordering to a
+// [net.PacketConn]. Use [Wrap] to impair the connections created by a
+// [dialonce.DialContextFunc]. The impairments are configured using a [*Config].
+//
+// All the random choices use a generator seeded using the Seed field of the
+// [*Config], so the same sequence of operations is impaired in the same way.
+// The connections created by [Wrap] use distinct streams of the generator,
+// selected by the order of the dials, so they are impaired differently.
+// These wrappers complement [github.com/rbmk-project/common/mocks.Conn]
+// and [github.com/rbmk-project/common/mocks.PacketConn], which allow to
+// simulate specific behavior without using real connections.
+package netimpair
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rbmk-project/common/dialonce"
+)
+
+// Config contains the impairments to apply.
+//
+// We apply latency and jitter by sleeping before each read and write, thus
+// wrapping one end of a connection impairs both directions. We apply the
+// bandwidth limits by sleeping before each write and after each read,
+// according to the number of bytes. We honor the deadlines set before each
+// operation starts, and Close interrupts sleeping operations.
+//
+// The zero value is ready to use and does not impair the network.
+type Config struct {
+	// Bandwidth is the OPTIONAL bandwidth limit in bytes per second,
+	// which we apply separately for reads and writes. If zero or
+	// negative, the bandwidth is unlimited.
+	Bandwidth int64
+
+	// Duplicate is the OPTIONAL probability to send a packet twice.
+	// We only use this field for [net.PacketConn].
+	Duplicate float64
+
+	// Jitter is the OPTIONAL maximum random delay we add to Latency.
+	Jitter time.Duration
+
+	// Latency is the OPTIONAL delay we add to each read and write.
+	Latency time.Duration
+
+	// Loss is the OPTIONAL probability to silently drop a packet.
+	// We only use this field for [net.PacketConn].
+	Loss float64
+
+	// Reorder is the OPTIONAL probability to hold a packet and send it after
+	// the next packet. We drop a held packet when closing the connection.
+	// We only use this field for [net.PacketConn].
+	Reorder float64
+
+	// ResetAfter is the OPTIONAL number of bytes read and written after which
+	// we reset the connection. If zero or negative, we never reset. We
+	// only use this field for [net.Conn].
+	ResetAfter int64
+
+	// Seed is the OPTIONAL seed for the random number generator. Each
+	// wrapper uses its own generator, therefore wrappers created using
+	// [WrapConn] or [WrapPacketConn] with the same Seed make the same
+	// random choices, while [Wrap] uses a distinct stream for each dial.
+	Seed uint64
+}
+
+// Wrap wraps a [dialonce.DialContextFunc] to impair each connection like [WrapConn]
+// does, except that each connection uses a distinct random stream (see Seed).
+func Wrap(dial dialonce.DialContextFunc, config *Config) dialonce.DialContextFunc {
+	var dials atomic.Uint64
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		stream := dials.Add(1)
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return newConn(conn, network, newImpairer(config, stream)), nil
+	}
+}
+
+// impairer contains the state shared by the connection wrappers.
+type impairer struct {
+	// closeOnce ensures we close the closed channel once.
+	closeOnce sync.Once
+
+	// closed is closed when the connection is closed.
+	closed chan struct{}
+
+	// config contains the impairments.
+	config *Config
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// readDeadline is the read deadline.
+	readDeadline time.Time
+
+	// rng is the random number generator.
+	rng *rand.Rand
+
+	// writeDeadline is the write deadline.
+	writeDeadline time.Time
+}
+
+// newImpairer creates a new [*impairer] using the given [*Config] and
+// the given stream of the random number generator seeded using Seed.
+func newImpairer(config *Config, stream uint64) *impairer {
+	return &impairer{
+		closed: make(chan struct{}),
+		config: config,
+		rng:    rand.New(rand.NewPCG(config.Seed, stream)),
+	}
+}
+
+// newOpError returns a [*net.OpError] wrapping the given error like
+// the errors returned by the standard library connections.
+func newOpError(op, network string, source, addr net.Addr, err error) error {
+	return &net.OpError{Op: op, Net: network, Source: source, Addr: addr, Err: err}
+}
+
+// chance returns true with the given probability.
+func (im *impairer) chance(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return im.rng.Float64() < probability
+}
+
+// latency returns Latency plus a random jitter.
+func (im *impairer) latency() time.Duration {
+	delay := im.config.Latency
+	if im.config.Jitter > 0 {
+		im.mu.Lock()
+		delay += time.Duration(im.rng.Int64N(int64(im.config.Jitter) + 1))
+		im.mu.Unlock()
+	}
+	return delay
+}
+
+// transmission returns the time to transfer the given number of bytes.
+func (im *impairer) transmission(count int) time.Duration {
+	if im.config.Bandwidth <= 0 {
+		return 0
+	}
+	return time.Duration(int64(count) * int64(time.Second) / im.config.Bandwidth)
+}
+
+// deadlines returns the read and write deadlines.
+func (im *impairer) deadlines() (time.Time, time.Time) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return im.readDeadline, im.writeDeadline
+}
+
+// sleep sleeps for the given duration unless the deadline expires, in which
+// case we return [os.ErrDeadlineExceeded], or we are closed, in which
+// case we return [net.ErrClosed].
+func (im *impairer) sleep(delay time.Duration, deadline time.Time) error {
+	if delay <= 0 {
+		return nil
+	}
+	expired := false
+	if !deadline.IsZero() {
+		if until := time.Until(deadline); until < delay {
+			delay, expired = max(until, 0), true
+		}
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		if expired {
+			return os.ErrDeadlineExceeded
+		}
+		return nil
+	case <-im.closed:
+		return net.ErrClosed
+	}
+}
+
+// close marks the impairer as closed to interrupt sleeping operations.
+func (im *impairer) close() {
+	im.closeOnce.Do(func() { close(im.closed) })
+}
+
+// setDeadline implements SetDeadline.
+func (im *impairer) setDeadline(t time.Time) {
+	im.mu.Lock()
+	im.readDeadline, im.writeDeadline = t, t
+	im.mu.Unlock()
+}
+
+// setReadDeadline implements SetReadDeadline.
+func (im *impairer) setReadDeadline(t time.Time) {
+	im.mu.Lock()
+	im.readDeadline = t
+	im.mu.Unlock()
+}
+
+// setWriteDeadline implements SetWriteDeadline.
+func (im *impairer) setWriteDeadline(t time.Time) {
+	im.mu.Lock()
+	im.writeDeadline = t
+	im.mu.Unlock()
+}
@@ -0,0 +1,287 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package netimpair
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rbmk-project/common/dialonce"
+	"github.com/rbmk-project/common/errclass"
+	"github.com/rbmk-project/common/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// make sure we can compose with the dialonce package
+var _ dialonce.DialContextFunc = Wrap((&net.Dialer{}).DialContext, &Config{})
+
+// newEchoServer starts a TCP server echoing what it receives.
+func newEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// dialEcho dials the echo server using the given [*Config].
+func dialEcho(t *testing.T, config *Config) net.Conn {
+	dial := Wrap((&net.Dialer{}).DialContext, config)
+	conn, err := dial(context.Background(), "tcp", newEchoServer(t))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// echo writes the message and reads it back.
+func echo(conn net.Conn, message string) (string, error) {
+	if _, err := conn.Write([]byte(message)); err != nil {
+		return "", err
+	}
+	buf := make([]byte, len(message))
+	_, err := io.ReadFull(conn, buf)
+	return string(buf), err
+}
+
+func TestConn(t *testing.T) {
+	t.Run("without impairments", func(t *testing.T) {
+		conn := dialEcho(t, &Config{})
+		got, err := echo(conn, "Bonsoir, Elliot!")
+		require.NoError(t, err)
+		assert.Equal(t, "Bonsoir, Elliot!", got)
+	})
+
+	t.Run("latency and jitter", func(t *testing.T) {
+		conn := dialEcho(t, &Config{Latency: 20 * time.Millisecond, Jitter: 10 * time.Millisecond})
+		t0 := time.Now()
+		_, err := echo(conn, "Bonsoir, Elliot!")
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(t0), 40*time.Millisecond)
+	})
+
+	t.Run("bandwidth", func(t *testing.T) {
+		conn := dialEcho(t, &Config{Bandwidth: 10000})
+		t0 := time.Now()
+		_, err := echo(conn, string(make([]byte, 500)))
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(t0), 100*time.Millisecond)
+	})
+
+	t.Run("deadlines", func(t *testing.T) {
+		conn := dialEcho(t, &Config{Latency: time.Hour})
+		require.NoError(t, conn.SetDeadline(time.Now().Add(20*time.Millisecond)))
+		_, err := conn.Write([]byte("abc"))
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		var opErr *net.OpError
+		require.True(t, errors.As(err, &opErr))
+		assert.Equal(t, "write", opErr.Op)
+		assert.Equal(t, "tcp", opErr.Net)
+		require.NoError(t, conn.SetWriteDeadline(time.Now().Add(-time.Second)))
+		_, err = conn.Write([]byte("abc"))
+		assert.Equal(t, errclass.ETIMEDOUT, errclass.New(err))
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+		_, err = conn.Read(make([]byte, 4))
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	})
+
+	t.Run("close interrupts sleeping operations", func(t *testing.T) {
+		conn := dialEcho(t, &Config{Latency: time.Hour})
+		time.AfterFunc(10*time.Millisecond, func() { conn.Close() })
+		_, err := conn.Read(make([]byte, 4))
+		assert.ErrorIs(t, err, net.ErrClosed)
+		var opErr *net.OpError
+		require.True(t, errors.As(err, &opErr))
+		assert.Equal(t, "read", opErr.Op)
+	})
+
+	t.Run("reset in the middle of a write", func(t *testing.T) {
+		conn := dialEcho(t, &Config{ResetAfter: 4})
+		count, err := conn.Write([]byte("Bonsoir"))
+		assert.Equal(t, 4, count)
+		assert.Equal(t, errclass.ECONNRESET, errclass.New(err))
+		var opErr *net.OpError
+		require.True(t, errors.As(err, &opErr))
+		assert.Equal(t, "write", opErr.Op)
+
+		// subsequent operations fail as well
+		_, err = conn.Read(make([]byte, 4))
+		assert.Equal(t, errclass.ECONNRESET, errclass.New(err))
+	})
+
+	t.Run("reset in the middle of a read", func(t *testing.T) {
+		conn := dialEcho(t, &Config{ResetAfter: 10})
+		_, err := conn.Write([]byte("Bonsoir"))
+		require.NoError(t, err)
+		buf := make([]byte, 7)
+		count, err := io.ReadFull(conn, buf)
+		assert.Equal(t, 3, count)
+		assert.Equal(t, "Bon", string(buf[:count]))
+		assert.Equal(t, errclass.ECONNRESET, errclass.New(err))
+	})
+
+	t.Run("reset of a conn without addresses", func(t *testing.T) {
+		conn := WrapConn(&mocks.Conn{
+			MockWrite:      func(b []byte) (int, error) { return len(b), nil },
+			MockClose:      func() error { return nil },
+			MockLocalAddr:  func() net.Addr { return nil },
+			MockRemoteAddr: func() net.Addr { return nil },
+		}, &Config{ResetAfter: 1})
+		count, err := conn.Write([]byte("ab"))
+		assert.Equal(t, 1, count)
+		assert.Equal(t, errclass.ECONNRESET, errclass.New(err))
+	})
+
+	t.Run("the peer observes the reset", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				accepted <- conn
+			}
+		}()
+
+		client, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		server := WrapConn(<-accepted, &Config{ResetAfter: 1})
+		defer server.Close()
+		_, err = server.Write([]byte("ab"))
+		require.Error(t, err)
+
+		client.SetDeadline(time.Now().Add(time.Second))
+		_, err = io.ReadAll(client)
+		assert.Equal(t, errclass.ECONNRESET, errclass.New(err))
+	})
+}
+
+func TestWrap(t *testing.T) {
+	t.Run("each conn uses a distinct random stream", func(t *testing.T) {
+		config := &Config{Seed: 4}
+		dial := Wrap(func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn1, conn2 := net.Pipe()
+			t.Cleanup(func() { conn1.Close(); conn2.Close() })
+			return conn1, nil
+		}, config)
+		first, err := dial(context.Background(), "tcp", "127.0.0.1:80")
+		require.NoError(t, err)
+		second, err := dial(context.Background(), "tcp", "127.0.0.1:80")
+		require.NoError(t, err)
+		assert.NotEqual(t, first.(*connWrapper).im.rng.Uint64(), second.(*connWrapper).im.rng.Uint64())
+		assert.Equal(t, "tcp", first.(*connWrapper).network)
+	})
+
+	t.Run("standalone wrappers with the same seed make the same choices", func(t *testing.T) {
+		config := &Config{Seed: 4}
+		conn1, conn2 := net.Pipe()
+		defer conn1.Close()
+		defer conn2.Close()
+		first, second := WrapConn(conn1, config), WrapConn(conn2, config)
+		assert.Equal(t, first.(*connWrapper).im.rng.Uint64(), second.(*connWrapper).im.rng.Uint64())
+	})
+}
+
+// newPacketConnPair creates a wrapped sender and a plain receiver.
+func newPacketConnPair(t *testing.T, config *Config) (net.PacketConn, net.PacketConn) {
+	sender, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	receiver, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	wrapped := WrapPacketConn(sender, config)
+	t.Cleanup(func() {
+		wrapped.Close()
+		receiver.Close()
+	})
+	return wrapped, receiver
+}
+
+// transfer sends the packets and returns the packets received before a short timeout.
+func transfer(t *testing.T, sender, receiver net.PacketConn, packets ...string) []string {
+	for _, packet := range packets {
+		count, err := sender.WriteTo([]byte(packet), receiver.LocalAddr())
+		require.NoError(t, err)
+		require.Equal(t, len(packet), count)
+	}
+	var received []string
+	buf := make([]byte, 1024)
+	for {
+		receiver.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		count, _, err := receiver.ReadFrom(buf)
+		if err != nil {
+			return received
+		}
+		received = append(received, string(buf[:count]))
+	}
+}
+
+func TestPacketConn(t *testing.T) {
+	packets := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}
+
+	t.Run("without impairments", func(t *testing.T) {
+		sender, receiver := newPacketConnPair(t, &Config{})
+		assert.Equal(t, packets, transfer(t, sender, receiver, packets...))
+	})
+
+	t.Run("loss", func(t *testing.T) {
+		sender, receiver := newPacketConnPair(t, &Config{Loss: 1})
+		assert.Empty(t, transfer(t, sender, receiver, packets...))
+	})
+
+	t.Run("duplication", func(t *testing.T) {
+		sender, receiver := newPacketConnPair(t, &Config{Duplicate: 1})
+		assert.Equal(t, []string{"0", "0", "1", "1"}, transfer(t, sender, receiver, "0", "1"))
+	})
+
+	t.Run("reordering", func(t *testing.T) {
+		sender, receiver := newPacketConnPair(t, &Config{Reorder: 1})
+		assert.Equal(t, []string{"1", "0", "3", "2"}, transfer(t, sender, receiver, "0", "1", "2", "3", "4"))
+	})
+
+	t.Run("the same seed produces the same impairments", func(t *testing.T) {
+		config := &Config{Loss: 0.3, Duplicate: 0.2, Reorder: 0.2, Seed: 4}
+		sender, receiver := newPacketConnPair(t, config)
+		first := transfer(t, sender, receiver, packets...)
+		sender, receiver = newPacketConnPair(t, config)
+		second := transfer(t, sender, receiver, packets...)
+		assert.Equal(t, first, second)
+		assert.NotEqual(t, packets, first)
+	})
+
+	t.Run("latency and deadlines", func(t *testing.T) {
+		sender, receiver := newPacketConnPair(t, &Config{Latency: 20 * time.Millisecond})
+		t0 := time.Now()
+		assert.Equal(t, []string{"0"}, transfer(t, sender, receiver, "0"))
+		assert.GreaterOrEqual(t, time.Since(t0), 20*time.Millisecond)
+
+		require.NoError(t, sender.SetDeadline(time.Now().Add(5*time.Millisecond)))
+		_, err := sender.WriteTo([]byte("0"), receiver.LocalAddr())
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		var opErr *net.OpError
+		require.True(t, errors.As(err, &opErr))
+		assert.Equal(t, "write", opErr.Op)
+		assert.Equal(t, "udp", opErr.Net)
+		assert.Equal(t, receiver.LocalAddr(), opErr.Addr)
+		require.NoError(t, sender.SetReadDeadline(time.Now().Add(5*time.Millisecond)))
+		_, _, err = sender.ReadFrom(make([]byte, 4))
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		require.NoError(t, sender.SetWriteDeadline(time.Time{}))
+	})
+}
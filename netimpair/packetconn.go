@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package netimpair
+
+import (
+	"net"
+	"time"
+
+	"github.com/rbmk-project/common/netipx"
+)
+
+// WrapPacketConn wraps a [net.PacketConn] to apply the impairments in the
+// given [*Config]. We apply loss, duplication, and reordering when writing,
+// thus these impairments only affect the packets we send. Like [WrapConn],
+// we wrap the errors caused by deadlines and by closing in a [*net.OpError].
+func WrapPacketConn(pconn net.PacketConn, config *Config) net.PacketConn {
+	return &packetConnWrapper{PacketConn: pconn, im: newImpairer(config, 0)}
+}
+
+// heldPacket is a packet held to reorder it.
+type heldPacket struct {
+	addr net.Addr
+	data []byte
+}
+
+// packetConnWrapper implements [WrapPacketConn].
+type packetConnWrapper struct {
+	// PacketConn is the underlying [net.PacketConn].
+	net.PacketConn
+
+	// held is the packet held for reordering, if any.
+	held *heldPacket
+
+	// im is the [*impairer] to use.
+	im *impairer
+}
+
+// ReadFrom implements [net.PacketConn].
+func (pc *packetConnWrapper) ReadFrom(buf []byte) (int, net.Addr, error) {
+	readDeadline, _ := pc.im.deadlines()
+	if err := pc.im.sleep(pc.im.latency(), readDeadline); err != nil {
+		return 0, nil, pc.opError("read", nil, err)
+	}
+	count, addr, err := pc.PacketConn.ReadFrom(buf)
+	pc.im.sleep(pc.im.transmission(count), time.Time{}) // we already have the data
+	return count, addr, err
+}
+
+// WriteTo implements [net.PacketConn].
+func (pc *packetConnWrapper) WriteTo(data []byte, addr net.Addr) (int, error) {
+	_, writeDeadline := pc.im.deadlines()
+	if err := pc.im.sleep(pc.im.latency()+pc.im.transmission(len(data)), writeDeadline); err != nil {
+		return 0, pc.opError("write", addr, err)
+	}
+
+	// Decide what to do using the random number generator in a fixed order.
+	lost := pc.im.chance(pc.im.config.Loss)
+	duplicate := pc.im.chance(pc.im.config.Duplicate)
+	reorder := pc.im.chance(pc.im.config.Reorder)
+	if lost {
+		return len(data), nil
+	}
+
+	// Take the held packet, if any, or hold the current packet.
+	pc.im.mu.Lock()
+	held := pc.held
+	pc.held = nil
+	if held == nil && reorder {
+		pc.held = &heldPacket{addr: addr, data: append([]byte{}, data...)}
+	}
+	pc.im.mu.Unlock()
+	if held == nil && reorder {
+		return len(data), nil
+	}
+
+	// Send the current packet followed by the held packet, if any.
+	count, err := pc.PacketConn.WriteTo(data, addr)
+	if err != nil {
+		return count, err
+	}
+	if duplicate {
+		pc.PacketConn.WriteTo(data, addr)
+	}
+	if held != nil {
+		pc.PacketConn.WriteTo(held.data, held.addr)
+	}
+	return count, nil
+}
+
+// opError wraps the given error for the given operation in a [*net.OpError].
+func (pc *packetConnWrapper) opError(op string, addr net.Addr, err error) error {
+	local := pc.PacketConn.LocalAddr()
+	return newOpError(op, netipx.AddrNetwork(local, ""), local, addr, err)
+}
+
+// Close implements [net.PacketConn].
+func (pc *packetConnWrapper) Close() error {
+	pc.im.close()
+	return pc.PacketConn.Close()
+}
+
+// SetDeadline implements [net.PacketConn].
+func (pc *packetConnWrapper) SetDeadline(t time.Time) error {
+	pc.im.setDeadline(t)
+	return pc.PacketConn.SetDeadline(t)
+}
+
+// SetReadDeadline implements [net.PacketConn].
+func (pc *packetConnWrapper) SetReadDeadline(t time.Time) error {
+	pc.im.setReadDeadline(t)
+	return pc.PacketConn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements [net.PacketConn].
+func (pc *packetConnWrapper) SetWriteDeadline(t time.Time) error {
+	pc.im.setWriteDeadline(t)
+	return pc.PacketConn.SetWriteDeadline(t)
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package netimpair
+
+import "golang.org/x/sys/windows"
+
+// errECONNRESET is the system error we use to simulate a reset.
+const errECONNRESET = windows.WSAECONNRESET
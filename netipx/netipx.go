@@ -27,3 +27,26 @@ func AddrToAddrPort(addr net.Addr) netip.AddrPort {
 	}
 	return netip.AddrPortFrom(netip.IPv6Unspecified(), 0)
 }
+
+// AddrNetwork returns the network of a [net.Addr] (e.g., "tcp").
+//
+// If the input is nil, returns the given fallback network.
+func AddrNetwork(addr net.Addr, fallback string) string {
+	if addr == nil {
+		return fallback
+	}
+	return addr.Network()
+}
+
+// ParseAddrPort parses a string containing an IP address and a port
+// (e.g., the [*net/http.Request] RemoteAddr field) to a [netip.AddrPort].
+//
+// If the input cannot be parsed, returns an unspecified IPv6 address
+// with port 0, consistently with [AddrToAddrPort].
+func ParseAddrPort(s string) netip.AddrPort {
+	addrport, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return netip.AddrPortFrom(netip.IPv6Unspecified(), 0)
+	}
+	return addrport
+}
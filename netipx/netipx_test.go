@@ -55,3 +55,85 @@ func TestAddrToAddrPort(t *testing.T) {
 		})
 	}
 }
+
+func TestAddrNetwork(t *testing.T) {
+	tests := []struct {
+		name     string
+		addr     net.Addr
+		fallback string
+		want     string
+	}{
+		{
+			name:     "nil address",
+			addr:     nil,
+			fallback: "tcp",
+			want:     "tcp",
+		},
+
+		{
+			name:     "TCP address",
+			addr:     &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234},
+			fallback: "",
+			want:     "tcp",
+		},
+
+		{
+			name:     "UDP address",
+			addr:     &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 5678},
+			fallback: "",
+			want:     "udp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := netipx.AddrNetwork(tt.addr, tt.fallback)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseAddrPort(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  netip.AddrPort
+	}{
+		{
+			name:  "empty string",
+			input: "",
+			want:  netip.AddrPortFrom(netip.IPv6Unspecified(), 0),
+		},
+
+		{
+			name:  "IPv4 address",
+			input: "192.0.2.1:443",
+			want:  netip.MustParseAddrPort("192.0.2.1:443"),
+		},
+
+		{
+			name:  "IPv6 address",
+			input: "[2001:db8::1]:8080",
+			want:  netip.MustParseAddrPort("[2001:db8::1]:8080"),
+		},
+
+		{
+			name:  "missing port",
+			input: "192.0.2.1",
+			want:  netip.AddrPortFrom(netip.IPv6Unspecified(), 0),
+		},
+
+		{
+			name:  "domain name",
+			input: "example.com:443",
+			want:  netip.AddrPortFrom(netip.IPv6Unspecified(), 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := netipx.ParseAddrPort(tt.input)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package netslog
+
+import (
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/rbmk-project/common/errclass"
+	"github.com/rbmk-project/common/netipx"
+)
+
+// WrapConn wraps a [net.Conn] to log the `read`, `write`, and `close` events
+// using the given logger. If the logger is nil, we return the original conn.
+//
+// The `protocol` field is the network of the conn local address, if any.
+func WrapConn(conn net.Conn, logger *slog.Logger) net.Conn {
+	if logger == nil {
+		return conn
+	}
+	return newConn(conn, netipx.AddrNetwork(conn.LocalAddr(), ""), logger, time.Now)
+}
+
+// newConn creates a new [*connWrapper] using the given protocol.
+func newConn(conn net.Conn, protocol string, logger *slog.Logger, timeNow func() time.Time) *connWrapper {
+	return &connWrapper{
+		Conn:       conn,
+		localAddr:  netipx.AddrToAddrPort(conn.LocalAddr()).String(),
+		logger:     logger,
+		protocol:   protocol,
+		remoteAddr: netipx.AddrToAddrPort(conn.RemoteAddr()).String(),
+		timeNow:    timeNow,
+	}
+}
+
+// connWrapper implements [WrapConn].
+type connWrapper struct {
+	// Conn is the underlying [net.Conn].
+	net.Conn
+
+	// localAddr is the local address.
+	localAddr string
+
+	// logger is the logger to use.
+	logger *slog.Logger
+
+	// protocol is the connection protocol.
+	protocol string
+
+	// remoteAddr is the remote address.
+	remoteAddr string
+
+	// timeNow returns the current time.
+	timeNow func() time.Time
+}
+
+// Read implements [net.Conn].
+func (c *connWrapper) Read(buf []byte) (int, error) {
+	t0 := c.timeNow()
+	count, err := c.Conn.Read(buf)
+	c.logIO("read", len(buf), count, err, t0)
+	return count, err
+}
+
+// Write implements [net.Conn].
+func (c *connWrapper) Write(data []byte) (int, error) {
+	t0 := c.timeNow()
+	count, err := c.Conn.Write(data)
+	c.logIO("write", len(data), count, err, t0)
+	return count, err
+}
+
+// logIO logs the result of a read or write.
+func (c *connWrapper) logIO(event string, bufferSize, count int, err error, t0 time.Time) {
+	t := c.timeNow()
+	c.logger.Info(
+		event,
+		slog.Any("err", err),
+		slog.Any("errClass", errclass.New(err)),
+		slog.Int("ioBufferSize", bufferSize),
+		slog.Int("ioBytesCount", count),
+		slog.String("localAddr", c.localAddr),
+		slog.String("protocol", c.protocol),
+		slog.String("remoteAddr", c.remoteAddr),
+		slog.Time("t0", t0),
+		slog.Time("t", t),
+		slog.Duration("duration", t.Sub(t0)),
+	)
+}
+
+// Close implements [net.Conn].
+func (c *connWrapper) Close() error {
+	t0 := c.timeNow()
+	err := c.Conn.Close()
+	t := c.timeNow()
+	c.logger.Info(
+		"close",
+		slog.Any("err", err),
+		slog.Any("errClass", errclass.New(err)),
+		slog.String("localAddr", c.localAddr),
+		slog.String("protocol", c.protocol),
+		slog.String("remoteAddr", c.remoteAddr),
+		slog.Time("t0", t0),
+		slog.Time("t", t),
+		slog.Duration("duration", t.Sub(t0)),
+	)
+	return err
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package netslog implements structured logging for network connections.
+//
+// Use [Wrap] to wrap a [dialonce.DialContextFunc] such that we log the
+// `connectStart` and `connectDone` events for each dial and we wrap the
+// returned connection using [WrapConn]. The wrapped connection logs the
+// `read`, `write`, and `close` events. Since we operate at the [net.Conn]
+// level, this gives us a network-level trace for any protocol, not just HTTP.
+//
+// Each `connectDone`, `read`, `write`, and `close` event describes a single
+// operation on the socket: `err` and `errClass` (see [errclass.New]) tell
+// how it ended, `t0` and `t` are when it started and returned, and `duration`
+// is how long it blocked. The `read` and `write` events also include the
+// `ioBufferSize` the caller passed and the `ioBytesCount` we transferred,
+// which allows to spot short reads and writes. All the events include the
+// connection addresses, which we convert using [netipx.AddrToAddrPort], and
+// the `protocol`, which is the network passed to the dial function.
+package netslog
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/rbmk-project/common/dialonce"
+	"github.com/rbmk-project/common/errclass"
+	"github.com/rbmk-project/common/netipx"
+)
+
+// Wrap wraps a [dialonce.DialContextFunc] to log each dial using the given
+// logger and to wrap each connection using [WrapConn]. If the logger is nil,
+// we return the original function.
+func Wrap(dial dialonce.DialContextFunc, logger *slog.Logger) dialonce.DialContextFunc {
+	if logger == nil {
+		return dial
+	}
+	return (&dialer{dial: dial, logger: logger, timeNow: time.Now}).DialContext
+}
+
+// dialer implements [Wrap].
+type dialer struct {
+	// dial is the underlying [dialonce.DialContextFunc].
+	dial dialonce.DialContextFunc
+
+	// logger is the logger to use.
+	logger *slog.Logger
+
+	// timeNow returns the current time.
+	timeNow func() time.Time
+}
+
+// DialContext dials a network connection with the given network and address.
+func (d *dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	t0 := d.timeNow()
+	d.logger.InfoContext(
+		ctx,
+		"connectStart",
+		slog.String("protocol", network),
+		slog.String("remoteAddr", address),
+		slog.Time("t", t0),
+	)
+
+	conn, err := d.dial(ctx, network, address)
+	t := d.timeNow()
+
+	// Use the actual remote address on success, since the
+	// given address may contain a domain name.
+	localAddr := netipx.AddrToAddrPort(nil).String()
+	remoteAddr := address
+	if err == nil {
+		localAddr = netipx.AddrToAddrPort(conn.LocalAddr()).String()
+		remoteAddr = netipx.AddrToAddrPort(conn.RemoteAddr()).String()
+	}
+
+	d.logger.InfoContext(
+		ctx,
+		"connectDone",
+		slog.Any("err", err),
+		slog.Any("errClass", errclass.New(err)),
+		slog.String("localAddr", localAddr),
+		slog.String("protocol", network),
+		slog.String("remoteAddr", remoteAddr),
+		slog.Time("t0", t0),
+		slog.Time("t", t),
+		slog.Duration("duration", t.Sub(t0)),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	return newConn(conn, network, d.logger, d.timeNow), nil
+}
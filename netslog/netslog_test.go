@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package netslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/rbmk-project/common/dialonce"
+	"github.com/rbmk-project/common/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// make sure we can compose with the dialonce package
+var _ dialonce.DialContextFunc = Wrap(dialonce.Wrap((&net.Dialer{}).DialContext), slog.Default())
+
+// parseJSONLines parses the JSON lines emitted by a [*slog.JSONHandler].
+func parseJSONLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var events []map[string]any
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var event map[string]any
+		require.NoError(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestWrap(t *testing.T) {
+	t.Run("with a successful dial", func(t *testing.T) {
+		// create an echo server
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			io.Copy(conn, conn)
+		}()
+
+		var out bytes.Buffer
+		dial := Wrap((&net.Dialer{}).DialContext, slog.New(slog.NewJSONHandler(&out, nil)))
+		conn, err := dial(context.Background(), "tcp4", listener.Addr().String())
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("Hello, World!"))
+		require.NoError(t, err)
+		buf := make([]byte, 128)
+		_, err = io.ReadAtLeast(conn, buf, len("Hello, World!"))
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+
+		events := parseJSONLines(t, &out)
+		require.GreaterOrEqual(t, len(events), 5)
+		var names []string
+		for _, event := range events {
+			names = append(names, event["msg"].(string))
+		}
+		assert.Equal(t, "connectStart", names[0])
+		assert.Equal(t, "connectDone", names[1])
+		assert.Equal(t, "write", names[2])
+		assert.Equal(t, "read", names[3])
+		assert.Equal(t, "close", names[len(names)-1])
+
+		done := events[1]
+		assert.Equal(t, "", done["errClass"])
+		assert.Equal(t, "tcp4", done["protocol"])
+		assert.Equal(t, conn.LocalAddr().String(), done["localAddr"])
+		assert.Equal(t, listener.Addr().String(), done["remoteAddr"])
+
+		write := events[2]
+		assert.Equal(t, float64(len("Hello, World!")), write["ioBufferSize"])
+		assert.Equal(t, float64(len("Hello, World!")), write["ioBytesCount"])
+		assert.Equal(t, "tcp4", write["protocol"])
+		assert.Equal(t, conn.LocalAddr().String(), write["localAddr"])
+		assert.Equal(t, listener.Addr().String(), write["remoteAddr"])
+
+		read := events[3]
+		assert.Equal(t, float64(128), read["ioBufferSize"])
+		assert.Equal(t, "", read["errClass"])
+		for _, event := range events[1:] {
+			assert.Contains(t, event, "t0")
+			assert.Contains(t, event, "duration")
+		}
+	})
+
+	t.Run("with a failed dial", func(t *testing.T) {
+		// obtain an address where nobody is listening
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		address := listener.Addr().String()
+		listener.Close()
+
+		var out bytes.Buffer
+		dial := Wrap((&net.Dialer{}).DialContext, slog.New(slog.NewJSONHandler(&out, nil)))
+		conn, err := dial(context.Background(), "tcp", address)
+		require.Error(t, err)
+		assert.Nil(t, conn)
+
+		events := parseJSONLines(t, &out)
+		require.Len(t, events, 2)
+		assert.Equal(t, "ECONNREFUSED", events[1]["errClass"])
+		assert.Equal(t, address, events[1]["remoteAddr"])
+		assert.Equal(t, "[::]:0", events[1]["localAddr"])
+	})
+
+	t.Run("with a read error", func(t *testing.T) {
+		conn1, conn2 := net.Pipe()
+		var out bytes.Buffer
+		conn := WrapConn(conn1, slog.New(slog.NewJSONHandler(&out, nil)))
+		conn2.Close()
+		_, err := conn.Read(make([]byte, 4))
+		require.ErrorIs(t, err, io.EOF)
+		conn.Close()
+
+		events := parseJSONLines(t, &out)
+		require.Len(t, events, 2)
+		assert.Equal(t, "read", events[0]["msg"])
+		assert.Equal(t, "EEOF", events[0]["errClass"])
+		assert.Equal(t, "pipe", events[0]["protocol"])
+		assert.Equal(t, "[::]:0", events[0]["remoteAddr"])
+	})
+
+	t.Run("with nil addresses", func(t *testing.T) {
+		mockConn := &mocks.Conn{
+			MockLocalAddr:  func() net.Addr { return nil },
+			MockRemoteAddr: func() net.Addr { return nil },
+			MockClose:      func() error { return nil },
+		}
+		var out bytes.Buffer
+		conn := WrapConn(mockConn, slog.New(slog.NewJSONHandler(&out, nil)))
+		require.NoError(t, conn.Close())
+
+		events := parseJSONLines(t, &out)
+		require.Len(t, events, 1)
+		assert.Equal(t, "", events[0]["protocol"])
+		assert.Equal(t, "[::]:0", events[0]["localAddr"])
+	})
+
+	t.Run("without a logger", func(t *testing.T) {
+		conn1, conn2 := net.Pipe()
+		defer conn1.Close()
+		defer conn2.Close()
+		assert.Equal(t, conn1, WrapConn(conn1, nil))
+		dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+			return conn1, nil
+		}
+		conn, err := Wrap(dial, nil)(context.Background(), "tcp", "127.0.0.1:80")
+		require.NoError(t, err)
+		assert.Equal(t, conn1, conn)
+	})
+}
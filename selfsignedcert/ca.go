@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package selfsignedcert
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"sync"
+
+	"github.com/rbmk-project/common/runtimex"
+)
+
+// CA is a self-signed certificate authority minting certificates on the fly,
+// which is useful to impersonate arbitrary servers in tests.
+//
+// Construct using [NewCA].
+type CA struct {
+	// Cert is the self-signed CA certificate.
+	Cert *Cert
+
+	// cache caches the minted [*tls.Certificate] by server name.
+	cache map[string]*tls.Certificate
+
+	// cert is the parsed CA certificate.
+	cert *x509.Certificate
+
+	// key is the CA private key.
+	key *ecdsa.PrivateKey
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+}
+
+// NewCA generates a new self-signed [*CA] with the given common name.
+//
+// This function panics on failure.
+func NewCA(commonName string) *CA {
+	cert, x509Cert, key := generate(&Config{CommonName: commonName}, true, nil, nil)
+	return &CA{
+		Cert:  cert,
+		cache: map[string]*tls.Certificate{},
+		cert:  x509Cert,
+		key:   key,
+	}
+}
+
+// CertPool returns a new [*x509.CertPool] containing the CA certificate.
+func (ca *CA) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// New generates a certificate and key with SANs signed by the CA.
+//
+// This method panics on failure.
+func (ca *CA) New(config *Config) *Cert {
+	cert, _, _ := generate(config, false, ca.cert, ca.key)
+	return cert
+}
+
+// TLSCertificate returns a [*tls.Certificate] signed by the CA for the given
+// server name or IP address, which we mint on the first use and cache.
+//
+// This method panics on failure.
+func (ca *CA) TLSCertificate(serverName string) *tls.Certificate {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if cert, found := ca.cache[serverName]; found {
+		return cert
+	}
+	config := &Config{CommonName: serverName, DNSNames: []string{serverName}}
+	if ip := net.ParseIP(serverName); ip != nil {
+		config.DNSNames, config.IPAddrs = nil, []net.IP{ip}
+	}
+	cert := ca.New(config)
+	tlsCert := runtimex.Try1(tls.X509KeyPair(cert.CertPEM, cert.KeyPEM))
+	ca.cache[serverName] = &tlsCert
+	return &tlsCert
+}
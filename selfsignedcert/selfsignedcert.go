@@ -1,6 +1,7 @@
 // SPDX-License-Identifier: GPL-3.0-or-later
 
-// Package selfsignedcert helps to create self-signed certificates.
+// Package selfsignedcert helps to create self-signed certificates as well as
+// a self-signed certificate authority minting certificates on the fly.
 package selfsignedcert
 
 import (
@@ -66,6 +67,17 @@ func (c *Cert) WriteFiles(baseDir string) {
 //
 // This function panics on failure.
 func New(config *Config) *Cert {
+	cert, _, _ := generate(config, false, nil, nil)
+	return cert
+}
+
+// generate generates a certificate and key with SANs signed by the given
+// parent and key, or a self-signed certificate if the parent is nil. The
+// isCA flag indicates whether the certificate can sign other certificates.
+//
+// This function panics on failure.
+func generate(config *Config, isCA bool, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey) (*Cert, *x509.Certificate, *ecdsa.PrivateKey) {
 	// Generate the private key
 	priv := runtimex.Try1(ecdsa.GenerateKey(elliptic.P256(), rand.Reader))
 
@@ -90,9 +102,20 @@ func New(config *Config) *Cert {
 	template.DNSNames = config.DNSNames
 	template.IPAddresses = config.IPAddrs
 
+	// Allow the certificate to sign other certificates if needed
+	if isCA {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+
+	// Self-sign unless we have a parent
+	if parent == nil {
+		parent, parentKey = &template, priv
+	}
+
 	// Generate the certificate proper and encoded to PEM
 	certDER := runtimex.Try1(x509.CreateCertificate(
-		rand.Reader, &template, &template, &priv.PublicKey, priv))
+		rand.Reader, &template, parent, &priv.PublicKey, parentKey))
 	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
 
 	// Generate the private key in PEM format
@@ -100,5 +123,6 @@ func New(config *Config) *Cert {
 	keyPEMBytes := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyPEM})
 
 	// Return the results
-	return &Cert{CertPEM: certPEM, KeyPEM: keyPEMBytes}
+	x509Cert := runtimex.Try1(x509.ParseCertificate(certDER))
+	return &Cert{CertPEM: certPEM, KeyPEM: keyPEMBytes}, x509Cert, priv
 }
@@ -66,3 +66,57 @@ func TestSelfSignedCert(t *testing.T) {
 		t.Fatal("expected", expectByes, ", got", body)
 	}
 }
+
+func TestCA(t *testing.T) {
+	// 1. generate the CA and a TLS listener minting certificates on the fly
+	ca := selfsignedcert.NewCA("RBMK Test CA")
+	serverConfig := &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return ca.TLSCertificate(hello.ServerName), nil
+		},
+	}
+	listener := runtimex.Try1(tls.Listen("tcp", "127.0.0.1:0", serverConfig))
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	// 2. make sure the handshake succeeds for arbitrary names
+	for _, serverName := range []string{"www.example.com", "www.example.org", "www.example.com"} {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+			RootCAs:    ca.CertPool(),
+			ServerName: serverName,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+
+	// 3. make sure the minted certificates are cached
+	if ca.TLSCertificate("www.example.com") != ca.TLSCertificate("www.example.com") {
+		t.Fatal("expected the certificate to be cached")
+	}
+
+	// 4. make sure we can mint certificates for IP addresses
+	leaf := runtimex.Try1(x509.ParseCertificate(ca.TLSCertificate("127.0.0.1").Certificate[0]))
+	if len(leaf.IPAddresses) != 1 || len(leaf.DNSNames) != 0 {
+		t.Fatal("expected a single IP address SAN, got", leaf.IPAddresses, leaf.DNSNames)
+	}
+
+	// 5. make sure certificates signed by the CA verify using the PEM encoding
+	pool := x509.NewCertPool()
+	runtimex.Assert(pool.AppendCertsFromPEM(ca.Cert.CertPEM), "cannot append PEM cert")
+	cert := ca.New(selfsignedcert.NewConfigExampleCom())
+	leaf = runtimex.Try1(x509.ParseCertificate(runtimex.Try1(tls.X509KeyPair(cert.CertPEM, cert.KeyPEM)).Certificate[0]))
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: pool, DNSName: "www.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+}